@@ -0,0 +1,495 @@
+package shred
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Aggregator describes an aggregation as an associative merge of partial
+// states. Init builds the state for a single record, Merge combines the
+// states of two groups of records (a precedes b in the input), and Result
+// turns the final state into the output value.
+type Aggregator interface {
+	Name() string
+	// Zero returns the state of an empty input, used when aggregating without
+	// keys over no records.
+	Zero() interface{}
+	Init(rec Record) interface{}
+	Merge(a, b interface{}) interface{}
+	Result(state interface{}) interface{}
+}
+
+type GroupedDataset struct {
+	dataset *Dataset
+	keys    []string
+	workers int
+}
+
+func (d *Dataset) GroupBy(keys ...string) *GroupedDataset {
+	return &GroupedDataset{
+		dataset: d,
+		keys:    keys,
+	}
+}
+
+// Parallel aggregates the groups with up to workers goroutines.
+func (g *GroupedDataset) Parallel(workers int) *GroupedDataset {
+	clone := *g
+	clone.workers = workers
+	return &clone
+}
+
+func (g *GroupedDataset) Aggregate(aggs ...Aggregator) *Dataset {
+	keys := g.keys
+	states := g.dataset.Map(func(r Record) Record {
+		state := make(Record, len(keys)+len(aggs))
+		for _, key := range keys {
+			state[key] = r.Get(key)
+		}
+		for _, agg := range aggs {
+			state[agg.Name()] = agg.Init(r)
+		}
+		return state
+	})
+
+	merge := func(a, b Record) Record {
+		for _, agg := range aggs {
+			a[agg.Name()] = agg.Merge(a[agg.Name()], b[agg.Name()])
+		}
+		return a
+	}
+
+	var reduced *Dataset
+	switch {
+	case len(keys) == 0:
+		reduced = states.Reduce(merge).TransformFactory(func() func(Iterator) (Record, error) {
+			emitted := false
+			return func(iterator Iterator) (Record, error) {
+				next, err := iterator.Next()
+				if err != nil || next != nil || emitted {
+					emitted = true
+					return next, err
+				}
+
+				// An empty input still aggregates to a single row.
+				emitted = true
+				zero := make(Record, len(aggs))
+				for _, agg := range aggs {
+					zero[agg.Name()] = agg.Zero()
+				}
+				return zero, nil
+			}
+		})
+	case g.workers > 1:
+		reduced = states.ParallelReduceByKeys(g.workers, keys, merge)
+	default:
+		reduced = states.ReduceByKeys(keys, merge)
+	}
+
+	return reduced.Map(func(r Record) Record {
+		for _, agg := range aggs {
+			r[agg.Name()] = agg.Result(r[agg.Name()])
+		}
+		return r
+	})
+}
+
+type namedAggregator struct {
+	Aggregator
+	name string
+}
+
+func (n namedAggregator) Name() string {
+	return n.name
+}
+
+func As(name string, agg Aggregator) Aggregator {
+	return namedAggregator{Aggregator: agg, name: name}
+}
+
+type countAggregator struct {
+	col string
+}
+
+func Count(col string) Aggregator {
+	return countAggregator{col: col}
+}
+
+func (c countAggregator) Name() string {
+	if c.col == "" {
+		return "count"
+	}
+
+	return "count(" + c.col + ")"
+}
+
+func (c countAggregator) Zero() interface{} {
+	return 0
+}
+
+func (c countAggregator) Init(rec Record) interface{} {
+	if c.col != "" && rec.Get(c.col) == nil {
+		return 0
+	}
+
+	return 1
+}
+
+func (c countAggregator) Merge(a, b interface{}) interface{} {
+	return a.(int) + b.(int)
+}
+
+func (c countAggregator) Result(state interface{}) interface{} {
+	return state
+}
+
+type sumAggregator struct {
+	col string
+}
+
+func Sum(col string) Aggregator {
+	return sumAggregator{col: col}
+}
+
+func (s sumAggregator) Name() string {
+	return "sum(" + s.col + ")"
+}
+
+func (s sumAggregator) Zero() interface{} {
+	return nil
+}
+
+func (s sumAggregator) Init(rec Record) interface{} {
+	n, _ := toNumber(rec.Get(s.col))
+	return n
+}
+
+func (s sumAggregator) Merge(a, b interface{}) interface{} {
+	return addNumbers(a, b)
+}
+
+func (s sumAggregator) Result(state interface{}) interface{} {
+	return state
+}
+
+type extremeAggregator struct {
+	col string
+	max bool
+}
+
+func Min(col string) Aggregator {
+	return extremeAggregator{col: col}
+}
+
+func Max(col string) Aggregator {
+	return extremeAggregator{col: col, max: true}
+}
+
+func (e extremeAggregator) Name() string {
+	if e.max {
+		return "max(" + e.col + ")"
+	}
+
+	return "min(" + e.col + ")"
+}
+
+func (e extremeAggregator) Zero() interface{} {
+	return nil
+}
+
+func (e extremeAggregator) Init(rec Record) interface{} {
+	return rec.Get(e.col)
+}
+
+func (e extremeAggregator) Merge(a, b interface{}) interface{} {
+	if a == nil {
+		return b
+	} else if b == nil {
+		return a
+	}
+
+	if c := compareValues(a, b); (e.max && c < 0) || (!e.max && c > 0) {
+		return b
+	}
+
+	return a
+}
+
+func (e extremeAggregator) Result(state interface{}) interface{} {
+	return state
+}
+
+type avgState struct {
+	Sum   float64
+	Count int
+}
+
+type avgAggregator struct {
+	col string
+}
+
+func Avg(col string) Aggregator {
+	return avgAggregator{col: col}
+}
+
+func (a avgAggregator) Name() string {
+	return "avg(" + a.col + ")"
+}
+
+func (a avgAggregator) Zero() interface{} {
+	return avgState{}
+}
+
+func (a avgAggregator) Init(rec Record) interface{} {
+	n, ok := toNumber(rec.Get(a.col))
+	if !ok {
+		return avgState{}
+	}
+
+	f, _ := toFloat(n)
+	return avgState{Sum: f, Count: 1}
+}
+
+func (a avgAggregator) Merge(x, y interface{}) interface{} {
+	xs, ys := x.(avgState), y.(avgState)
+	return avgState{Sum: xs.Sum + ys.Sum, Count: xs.Count + ys.Count}
+}
+
+func (a avgAggregator) Result(state interface{}) interface{} {
+	s := state.(avgState)
+	if s.Count == 0 {
+		return nil
+	}
+
+	return s.Sum / float64(s.Count)
+}
+
+type distinctAggregator struct {
+	col string
+}
+
+func CountDistinct(col string) Aggregator {
+	return distinctAggregator{col: col}
+}
+
+func (d distinctAggregator) Name() string {
+	return "count_distinct(" + d.col + ")"
+}
+
+func (d distinctAggregator) Zero() interface{} {
+	return map[interface{}]bool{}
+}
+
+func (d distinctAggregator) Init(rec Record) interface{} {
+	set := map[interface{}]bool{}
+	if val := rec.Get(d.col); val != nil {
+		set[normalizeKey(val)] = true
+	}
+	return set
+}
+
+func (d distinctAggregator) Merge(a, b interface{}) interface{} {
+	as, bs := a.(map[interface{}]bool), b.(map[interface{}]bool)
+	if len(as) < len(bs) {
+		as, bs = bs, as
+	}
+
+	for val := range bs {
+		as[val] = true
+	}
+	return as
+}
+
+func (d distinctAggregator) Result(state interface{}) interface{} {
+	return len(state.(map[interface{}]bool))
+}
+
+type positionAggregator struct {
+	col  string
+	last bool
+}
+
+func First(col string) Aggregator {
+	return positionAggregator{col: col}
+}
+
+func Last(col string) Aggregator {
+	return positionAggregator{col: col, last: true}
+}
+
+func (p positionAggregator) Name() string {
+	if p.last {
+		return "last(" + p.col + ")"
+	}
+
+	return "first(" + p.col + ")"
+}
+
+func (p positionAggregator) Zero() interface{} {
+	return nil
+}
+
+func (p positionAggregator) Init(rec Record) interface{} {
+	return rec.Get(p.col)
+}
+
+func (p positionAggregator) Merge(a, b interface{}) interface{} {
+	if p.last {
+		return b
+	}
+
+	return a
+}
+
+func (p positionAggregator) Result(state interface{}) interface{} {
+	return state
+}
+
+type collectAggregator struct {
+	col string
+}
+
+func Collect(col string) Aggregator {
+	return collectAggregator{col: col}
+}
+
+func (c collectAggregator) Name() string {
+	return "collect(" + c.col + ")"
+}
+
+func (c collectAggregator) Zero() interface{} {
+	return []interface{}{}
+}
+
+func (c collectAggregator) Init(rec Record) interface{} {
+	return []interface{}{rec.Get(c.col)}
+}
+
+func (c collectAggregator) Merge(a, b interface{}) interface{} {
+	return append(a.([]interface{}), b.([]interface{})...)
+}
+
+func (c collectAggregator) Result(state interface{}) interface{} {
+	return state
+}
+
+// maxCentroids bounds the size of a percentile sketch. Once a sketch holds
+// twice as many centroids, adjacent pairs are merged into their weighted mean.
+const maxCentroids = 256
+
+type percentileState struct {
+	Min     float64
+	Max     float64
+	Means   []float64
+	Weights []float64
+}
+
+type percentileAggregator struct {
+	col string
+	p   float64
+}
+
+// Percentile approximates the p-th percentile (0 <= p <= 1) of a column. The
+// result is exact, using linear interpolation, until a group exceeds the
+// sketch size.
+func Percentile(col string, p float64) Aggregator {
+	return percentileAggregator{col: col, p: p}
+}
+
+func (p percentileAggregator) Name() string {
+	return fmt.Sprintf("percentile(%s, %v)", p.col, p.p)
+}
+
+func (p percentileAggregator) Zero() interface{} {
+	return percentileState{}
+}
+
+func (p percentileAggregator) Init(rec Record) interface{} {
+	n, ok := toNumber(rec.Get(p.col))
+	if !ok {
+		return percentileState{}
+	}
+
+	f, _ := toFloat(n)
+	return percentileState{Min: f, Max: f, Means: []float64{f}, Weights: []float64{1}}
+}
+
+func (p percentileAggregator) Merge(a, b interface{}) interface{} {
+	as, bs := a.(percentileState), b.(percentileState)
+	if len(as.Means) == 0 {
+		return bs
+	} else if len(bs.Means) == 0 {
+		return as
+	}
+
+	merged := percentileState{
+		Min:     math.Min(as.Min, bs.Min),
+		Max:     math.Max(as.Max, bs.Max),
+		Means:   make([]float64, 0, len(as.Means)+len(bs.Means)),
+		Weights: make([]float64, 0, len(as.Means)+len(bs.Means)),
+	}
+
+	i, j := 0, 0
+	for i < len(as.Means) || j < len(bs.Means) {
+		if j == len(bs.Means) || (i < len(as.Means) && as.Means[i] <= bs.Means[j]) {
+			merged.Means = append(merged.Means, as.Means[i])
+			merged.Weights = append(merged.Weights, as.Weights[i])
+			i++
+		} else {
+			merged.Means = append(merged.Means, bs.Means[j])
+			merged.Weights = append(merged.Weights, bs.Weights[j])
+			j++
+		}
+	}
+
+	if len(merged.Means) < 2*maxCentroids {
+		return merged
+	}
+
+	compressed := percentileState{Min: merged.Min, Max: merged.Max}
+	for k := 0; k < len(merged.Means); k += 2 {
+		if k+1 == len(merged.Means) {
+			compressed.Means = append(compressed.Means, merged.Means[k])
+			compressed.Weights = append(compressed.Weights, merged.Weights[k])
+			break
+		}
+
+		w := merged.Weights[k] + merged.Weights[k+1]
+		m := (merged.Means[k]*merged.Weights[k] + merged.Means[k+1]*merged.Weights[k+1]) / w
+		compressed.Means = append(compressed.Means, m)
+		compressed.Weights = append(compressed.Weights, w)
+	}
+
+	return compressed
+}
+
+func (p percentileAggregator) Result(state interface{}) interface{} {
+	s := state.(percentileState)
+	if len(s.Means) == 0 {
+		return nil
+	}
+
+	// Each centroid is centered within the range of ranks it covers.
+	centers := make([]float64, len(s.Means))
+	total := 0.0
+	for i, w := range s.Weights {
+		centers[i] = total + (w-1)/2
+		total += w
+	}
+
+	// The exact extremes anchor the first and last ranks.
+	centers = append(append([]float64{0}, centers...), total-1)
+	means := append(append([]float64{s.Min}, s.Means...), s.Max)
+
+	rank := p.p * (total - 1)
+	i := sort.SearchFloat64s(centers, rank)
+	if i == 0 {
+		return means[0]
+	} else if i == len(centers) {
+		return means[len(means)-1]
+	}
+
+	frac := (rank - centers[i-1]) / (centers[i] - centers[i-1])
+	return means[i-1] + frac*(means[i]-means[i-1])
+}
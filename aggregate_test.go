@@ -0,0 +1,168 @@
+package shred
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDatasetGroupByAggregate(t *testing.T) {
+	input := &RecordIterator{
+		{"user_id": 1, "order_id": 1, "total_price": 25},
+		{"user_id": 1, "order_id": 2, "total_price": 55.5},
+		{"user_id": 2, "order_id": 3, "total_price": "11"},
+		{"user_id": 1, "order_id": 4, "total_price": nil},
+	}
+	expected := []Record{
+		{
+			"user_id":                  1,
+			"count":                    3,
+			"count(total_price)":       2,
+			"sum(total_price)":         80.5,
+			"min(total_price)":         25,
+			"max(order_id)":            4,
+			"avg(total_price)":         40.25,
+			"count_distinct(order_id)": 3,
+			"first(order_id)":          1,
+			"last(order_id)":           4,
+			"orders":                   []interface{}{1, 2, 4},
+		},
+		{
+			"user_id":                  2,
+			"count":                    1,
+			"count(total_price)":       1,
+			"sum(total_price)":         11,
+			"min(total_price)":         "11",
+			"max(order_id)":            3,
+			"avg(total_price)":         11.0,
+			"count_distinct(order_id)": 1,
+			"first(order_id)":          3,
+			"last(order_id)":           3,
+			"orders":                   []interface{}{3},
+		},
+	}
+
+	actual, err := NewDataset(input).GroupBy("user_id").Aggregate(
+		Count(""),
+		Count("total_price"),
+		Sum("total_price"),
+		Min("total_price"),
+		Max("order_id"),
+		Avg("total_price"),
+		CountDistinct("order_id"),
+		First("order_id"),
+		Last("order_id"),
+		As("orders", Collect("order_id")),
+	).SortInt("user_id").Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected: %v\nactual: %v", expected, actual)
+	}
+}
+
+func TestDatasetGroupByMultipleKeys(t *testing.T) {
+	input := &RecordIterator{
+		{"a": 1, "b": "x", "n": 1},
+		{"a": 1, "b": "y", "n": 2},
+		{"a": 1, "b": "x", "n": 3},
+		{"a": 2, "b": "x", "n": 5},
+	}
+	expected := []Record{
+		{"a": 1, "b": "y", "sum(n)": 2},
+		{"a": 1, "b": "x", "sum(n)": 4},
+		{"a": 2, "b": "x", "sum(n)": 5},
+	}
+
+	actual, err := NewDataset(input).GroupBy("a", "b").Aggregate(Sum("n")).SortInt("sum(n)").Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected: %v\nactual: %v", expected, actual)
+	}
+}
+
+func TestDatasetAggregateWithoutKeys(t *testing.T) {
+	input := &RecordIterator{}
+	for i := 1; i <= 1001; i++ {
+		*input = append(*input, Record{"n": i})
+	}
+	expected := Record{"count": 1001.0, "p0": 1.0, "p50": 501.0, "p90": 901.0, "p100": 1001.0}
+
+	actual, err := NewDataset(input).GroupBy().Aggregate(
+		Count(""),
+		As("p0", Percentile("n", 0)),
+		As("p50", Percentile("n", 0.5)),
+		As("p90", Percentile("n", 0.9)),
+		As("p100", Percentile("n", 1)),
+	).Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actual) != 1 {
+		t.Fatalf("unexpected: %v", actual)
+	}
+	for key, val := range expected {
+		if diff := actual[0].Float(key) - val.(float64); diff < -1 || diff > 1 {
+			t.Fatalf("%s\nexpected: %v\nactual: %v", key, expected, actual)
+		}
+	}
+	if actual[0]["p0"] != 1.0 || actual[0]["p100"] != 1001.0 {
+		t.Fatalf("unexpected: %v", actual)
+	}
+}
+
+func TestDatasetAggregateEmpty(t *testing.T) {
+	expected := []Record{
+		{"count": 0, "sum(n)": nil, "avg(n)": nil, "min(n)": nil, "max(n)": nil, "count_distinct(n)": 0, "percentile(n, 0.5)": nil},
+	}
+
+	actual, err := NewDataset(&RecordIterator{}).GroupBy().Aggregate(
+		Count(""),
+		Sum("n"),
+		Avg("n"),
+		Min("n"),
+		Max("n"),
+		CountDistinct("n"),
+		Percentile("n", 0.5),
+	).Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected: %v\nactual: %v", expected, actual)
+	}
+
+	actual, err = NewDataset(&RecordIterator{}).GroupBy("user_id").Aggregate(Count("")).Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actual) != 0 {
+		t.Fatalf("unexpected: %v", actual)
+	}
+}
+
+func TestDatasetAggregateNumericStrings(t *testing.T) {
+	input := &RecordIterator{
+		{"price": "10"},
+		{"price": "9"},
+		{"price": "100"},
+	}
+	expected := []Record{
+		{"min(price)": "9", "max(price)": "100"},
+	}
+
+	actual, err := NewDataset(input).GroupBy().Aggregate(Min("price"), Max("price")).Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected: %v\nactual: %v", expected, actual)
+	}
+}
@@ -0,0 +1,231 @@
+package shred
+
+import (
+	"bufio"
+	"context"
+	"encoding/gob"
+	"io"
+	"os"
+	"sync"
+)
+
+// Cache materializes the records of the dataset in memory the first time the
+// returned dataset, or any of its clones, is read. Clones are then served from
+// memory without reading d again, until Invalidate is called.
+func (d *Dataset) Cache() *Dataset {
+	return d.cache(&cacheStore{source: d.Clone()})
+}
+
+// Persist is like Cache, but stores the records in a file at path instead of
+// in memory. The file is replaced when the records are materialized again
+// after Invalidate.
+func (d *Dataset) Persist(path string) *Dataset {
+	return d.cache(&cacheStore{source: d.Clone(), path: path})
+}
+
+func (d *Dataset) cache(store *cacheStore) *Dataset {
+	cached := &Dataset{
+		input:    &cacheIterator{store: store},
+		settings: d.settings,
+	}
+	cached.caches = append(append([]*cacheStore{}, d.caches...), store)
+	return cached
+}
+
+// Invalidate discards the records materialized by Cache or Persist anywhere
+// in the dataset, including the other inputs of joins and unions, so that
+// they are read again from their source. Iterators that are already reading
+// the old records are not affected.
+func (d *Dataset) Invalidate() error {
+	var err error
+	for _, store := range d.caches {
+		if storeErr := store.invalidate(); err == nil {
+			err = storeErr
+		}
+	}
+	return err
+}
+
+// includeCaches adds the caches read by it, another input of d, to d.
+func (d *Dataset) includeCaches(it Iterator) *Dataset {
+	if other, ok := it.(*Dataset); ok && len(other.caches) > 0 {
+		d.caches = append(append([]*cacheStore{}, d.caches...), other.caches...)
+	}
+	return d
+}
+
+// cacheStore holds the materialized records shared by every clone of a cached
+// dataset, either in memory or, with a path, in a file.
+type cacheStore struct {
+	mu      sync.Mutex
+	source  Iterator
+	path    string
+	ready   bool
+	records []Record
+}
+
+func (c *cacheStore) materialize(ctx context.Context) error {
+	source := bindContext(c.source.Clone(), ctx)
+	defer closeIterator(source)
+
+	if c.path == "" {
+		records := []Record{}
+		for {
+			next, err := source.Next()
+			if err != nil {
+				return err
+			} else if next == nil {
+				break
+			}
+			records = append(records, next)
+		}
+
+		c.records = records
+		return nil
+	}
+
+	// Write to a temporary file first so that readers of the previous file
+	// are not disturbed.
+	tmp := c.path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	enc := gob.NewEncoder(writer)
+	for {
+		next, err := source.Next()
+		if err == nil && next == nil {
+			err = writer.Flush()
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			if err == nil {
+				return os.Rename(tmp, c.path)
+			}
+		} else if err == nil {
+			if err = registerValues(next); err == nil {
+				err = enc.Encode(next)
+			}
+		}
+
+		if err != nil {
+			file.Close()
+			os.Remove(tmp)
+			return err
+		}
+	}
+}
+
+// open returns an iterator over the materialized records, materializing them
+// first if needed.
+func (c *cacheStore) open(ctx context.Context) (Iterator, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.ready {
+		if err := c.materialize(ctx); err != nil {
+			return nil, err
+		}
+		c.ready = true
+	}
+
+	if c.path == "" {
+		return newSliceIterator(c.records), nil
+	}
+
+	file, err := os.Open(c.path)
+	if err != nil {
+		return nil, err
+	}
+	return &fileIterator{file: file, dec: gob.NewDecoder(bufio.NewReader(file))}, nil
+}
+
+func (c *cacheStore) invalidate() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.ready = false
+	c.records = nil
+	if c.path == "" {
+		return nil
+	}
+
+	if err := os.Remove(c.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+type cacheIterator struct {
+	store   *cacheStore
+	ctx     context.Context
+	records Iterator
+}
+
+func (c *cacheIterator) Clone() Iterator {
+	return &cacheIterator{store: c.store, ctx: c.ctx}
+}
+
+// WithContext binds the read that materializes the records, if this iterator
+// is the one to trigger it, to ctx.
+func (c *cacheIterator) WithContext(ctx context.Context) Iterator {
+	return &cacheIterator{store: c.store, ctx: ctx}
+}
+
+// Next returns copies of the materialized records, since transformations may
+// modify the records they are given.
+func (c *cacheIterator) Next() (Record, error) {
+	if c.records == nil {
+		var err error
+		if c.records, err = c.store.open(c.ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	next, err := c.records.Next()
+	if err != nil || next == nil {
+		return next, err
+	}
+	return next.Clone(), nil
+}
+
+func (c *cacheIterator) Close() error {
+	return closeIterator(c.records)
+}
+
+// fileIterator reads the gob encoded records of a persisted dataset.
+type fileIterator struct {
+	file   *os.File
+	dec    *gob.Decoder
+	closed bool
+}
+
+func (f *fileIterator) Clone() Iterator {
+	panic("shred: file iterator cannot be cloned")
+}
+
+func (f *fileIterator) Next() (Record, error) {
+	if f.closed {
+		return nil, nil
+	}
+
+	var rec Record
+	if err := f.dec.Decode(&rec); err == io.EOF {
+		return nil, f.Close()
+	} else if err != nil {
+		return nil, err
+	}
+
+	return rec, nil
+}
+
+func (f *fileIterator) Close() error {
+	if f.closed {
+		return nil
+	}
+
+	f.closed = true
+	return f.file.Close()
+}
@@ -0,0 +1,172 @@
+package shred
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDatasetCache(t *testing.T) {
+	calls := int64(0)
+	input := &CountingIterator{RecordIterator: RecordIterator{{"foo": 1}, {"foo": 2}}, calls: &calls}
+	expected := []Record{
+		{"foo": 1},
+		{"foo": 2},
+	}
+
+	cached := NewDataset(input).Cache()
+	for i, iterator := range []Iterator{cached, cached.Clone(), cached.Clone()} {
+		actual, err := NewDataset(iterator).Map(func(r Record) Record {
+			// Modifying the records must not affect the cache.
+			r["foo"] = 0
+			return r
+		}).Filter(func(r Record) bool {
+			return false
+		}).Union(iterator.Clone()).Collect()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(expected, actual) {
+			t.Fatalf("#%d\nexpected: %v\nactual: %v", i, expected, actual)
+		}
+	}
+
+	if n := atomic.LoadInt64(&calls); n != 3 {
+		t.Fatalf("expected the source to be read once, found %d reads", n)
+	}
+
+	if err := cached.Map(func(r Record) Record { return r }).Invalidate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cached.Clone().(*Dataset).Collect(); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt64(&calls); n != 6 {
+		t.Fatalf("expected the source to be read again, found %d reads", n)
+	}
+}
+
+func TestDatasetPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "orders.gob")
+	calls := int64(0)
+	input := &CountingIterator{RecordIterator: RecordIterator{{"foo": 1, "bar": "a"}, {"foo": 2, "bar": nil}}, calls: &calls}
+	expected := []Record{
+		{"foo": 1, "bar": "a"},
+		{"foo": 2, "bar": nil},
+	}
+
+	persisted := NewDataset(input).Persist(path)
+	for i := 0; i < 3; i++ {
+		actual, err := persisted.Clone().(*Dataset).Collect()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(expected, actual) {
+			t.Fatalf("#%d\nexpected: %v\nactual: %v", i, expected, actual)
+		}
+	}
+
+	if n := atomic.LoadInt64(&calls); n != 3 {
+		t.Fatalf("expected the source to be read once, found %d reads", n)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := persisted.Invalidate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected the file to be removed, found %v", err)
+	}
+}
+
+func TestDatasetCacheError(t *testing.T) {
+	cached := NewDataset(&FailingIterator{}).Cache()
+
+	for i := 0; i < 2; i++ {
+		if _, err := cached.Clone().(*Dataset).Collect(); err != ErrFailingIterator {
+			t.Fatalf("#%d\nexpected: %v\nactual: %v", i, ErrFailingIterator, err)
+		}
+	}
+}
+
+func TestDatasetInvalidateChains(t *testing.T) {
+	identity := func(r Record) Record { return r }
+	chains := []func(cached *Dataset) *Dataset{
+		func(cached *Dataset) *Dataset {
+			return cached.WithContext(context.Background())
+		},
+		func(cached *Dataset) *Dataset {
+			return cached.Map(identity).Pipelined(2)
+		},
+		func(cached *Dataset) *Dataset {
+			return cached.Prefetch(2).Filter(func(Record) bool { return true })
+		},
+		func(cached *Dataset) *Dataset {
+			return NewDataset(&RecordIterator{}).Union(cached.Map(identity))
+		},
+		func(cached *Dataset) *Dataset {
+			return NewDataset(&RecordIterator{{"foo": 1}}).InnerJoin("foo", "foo", cached)
+		},
+		func(cached *Dataset) *Dataset {
+			return NewDataset(cached.Clone())
+		},
+	}
+
+	for i, chain := range chains {
+		calls := int64(0)
+		input := &CountingIterator{RecordIterator: RecordIterator{{"foo": 1}}, calls: &calls}
+		dataset := chain(NewDataset(input).Cache())
+
+		for j := 0; j < 2; j++ {
+			if _, err := dataset.Clone().(*Dataset).Collect(); err != nil {
+				t.Fatalf("#%d: %v", i, err)
+			}
+		}
+		if err := dataset.Invalidate(); err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if _, err := dataset.Clone().(*Dataset).Collect(); err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+
+		if n := atomic.LoadInt64(&calls); n != 4 {
+			t.Fatalf("#%d expected the source to be read twice, found %d reads", i, n)
+		}
+	}
+}
+
+func TestDatasetCacheWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := int64(0)
+	input := &CountingIterator{RecordIterator: *parallelInput(1001), calls: &calls}
+
+	cached := NewDataset(input).Map(func(r Record) Record {
+		if r.Int("foo") == 10 {
+			cancel()
+		}
+		return r
+	}).Cache()
+
+	_, err := cached.WithContext(ctx).Collect()
+	if err != context.Canceled {
+		t.Fatalf("expected: %v\nactual: %v", context.Canceled, err)
+	}
+	if n := atomic.LoadInt64(&calls); n > 20 {
+		t.Fatalf("expected the fill to stop once cancelled, found %d reads", n)
+	}
+
+	// A cancelled fill leaves nothing behind for the next reader.
+	actual, err := cached.Clone().(*Dataset).Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actual) != 1001 {
+		t.Fatalf("expected 1001 records, found %d", len(actual))
+	}
+}
@@ -1,13 +1,17 @@
 package shred
 
 import (
+	"context"
+
 	"github.com/gocql/gocql"
 )
 
 type CassandraIterator struct {
+	ctx     context.Context
 	session *gocql.Session
 	query   string
 	iter    *gocql.Iter
+	done    bool
 }
 
 func NewCassandraIterator(session *gocql.Session, query string) *CassandraIterator {
@@ -20,6 +24,17 @@ func NewCassandraIterator(session *gocql.Session, query string) *CassandraIterat
 
 func (c *CassandraIterator) Clone() Iterator {
 	return &CassandraIterator{
+		ctx:     c.ctx,
+		session: c.session,
+		query:   c.query,
+		iter:    nil,
+	}
+}
+
+// WithContext returns a copy of the iterator that runs its query with ctx.
+func (c *CassandraIterator) WithContext(ctx context.Context) Iterator {
+	return &CassandraIterator{
+		ctx:     ctx,
 		session: c.session,
 		query:   c.query,
 		iter:    nil,
@@ -27,8 +42,16 @@ func (c *CassandraIterator) Clone() Iterator {
 }
 
 func (c *CassandraIterator) Next() (Record, error) {
+	if c.done {
+		return nil, nil
+	}
+
 	if c.iter == nil {
-		c.iter = c.session.Query(c.query).Iter()
+		query := c.session.Query(c.query)
+		if c.ctx != nil {
+			query = query.WithContext(c.ctx)
+		}
+		c.iter = query.Iter()
 	}
 
 	buf := make(map[string]interface{})
@@ -47,8 +70,21 @@ func (c *CassandraIterator) Next() (Record, error) {
 			buf[k] = int(v)
 		case int64:
 			buf[k] = int(v)
+		case float32:
+			buf[k] = float64(v)
 		}
 	}
 
 	return Record(buf), nil
 }
+
+// Close releases the iterator of the query. Next returns no more records
+// afterwards.
+func (c *CassandraIterator) Close() error {
+	c.done = true
+	if c.iter == nil {
+		return nil
+	}
+
+	return c.iter.Close()
+}
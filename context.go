@@ -0,0 +1,76 @@
+package shred
+
+import (
+	"context"
+)
+
+// ContextIterator is implemented by sources that can run under a context,
+// such as database iterators, so that cancelling the context interrupts them.
+type ContextIterator interface {
+	Iterator
+	WithContext(ctx context.Context) Iterator
+}
+
+// WithContext binds the dataset, every dataset it is derived from and their
+// sources to ctx. Once ctx is done, Next returns ctx.Err().
+func (d *Dataset) WithContext(ctx context.Context) *Dataset {
+	clone := d.configure()
+	clone.input = bindContext(clone.input, ctx)
+	clone.ctx = ctx
+	return clone
+}
+
+func (d *Dataset) checkContext() error {
+	if d.ctx == nil {
+		return nil
+	}
+	return d.ctx.Err()
+}
+
+// bindContext binds it to ctx. Iterators that are not aware of contexts are
+// wrapped so that they stop once ctx is done.
+func bindContext(it Iterator, ctx context.Context) Iterator {
+	if ctx == nil {
+		return it
+	}
+
+	switch it := it.(type) {
+	case *Dataset:
+		return it.WithContext(ctx)
+	case ContextIterator:
+		return it.WithContext(ctx)
+	case *contextIterator:
+		return &contextIterator{iterator: it.iterator, ctx: ctx}
+	default:
+		return &contextIterator{iterator: it, ctx: ctx}
+	}
+}
+
+// contextOf returns the context that the input of a transformation is bound
+// to, so that the transformation can bind its other inputs to it.
+func contextOf(it Iterator) context.Context {
+	if d, ok := it.(*Dataset); ok {
+		return d.ctx
+	}
+	return nil
+}
+
+type contextIterator struct {
+	iterator Iterator
+	ctx      context.Context
+}
+
+func (c *contextIterator) Clone() Iterator {
+	return &contextIterator{iterator: c.iterator.Clone(), ctx: c.ctx}
+}
+
+func (c *contextIterator) Next() (Record, error) {
+	if err := c.ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.iterator.Next()
+}
+
+func (c *contextIterator) Close() error {
+	return closeIterator(c.iterator)
+}
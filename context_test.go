@@ -0,0 +1,96 @@
+package shred
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// BoundIterator records the context it was bound to across its clones.
+type BoundIterator struct {
+	RecordIterator
+	bound *context.Context
+}
+
+func (b *BoundIterator) Clone() Iterator {
+	return &BoundIterator{RecordIterator: *b.RecordIterator.Clone().(*RecordIterator), bound: b.bound}
+}
+
+func (b *BoundIterator) WithContext(ctx context.Context) Iterator {
+	*b.bound = ctx
+	return b.Clone()
+}
+
+func TestDatasetWithContextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	input := NewClosingIterator(Record{"foo": 1}, Record{"foo": 2}, Record{"foo": 3})
+
+	dataset := NewDataset(input).WithContext(ctx).Map(func(r Record) Record {
+		if r.Int("foo") == 2 {
+			cancel()
+		}
+		return r
+	})
+
+	actual, err := dataset.Collect()
+
+	if err != context.Canceled {
+		t.Fatalf("expected: %v\nactual: %v", context.Canceled, err)
+	}
+	if actual != nil {
+		t.Fatalf("unexpected: %v", actual)
+	}
+	if input.stats.next != 2 || input.stats.closed == 0 {
+		t.Fatalf("expected 2 reads and a close, found %d reads and %d closes", input.stats.next, input.stats.closed)
+	}
+}
+
+func TestDatasetWithContextDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+
+	input := &RecordIterator{
+		{"foo": 2},
+		{"foo": 1},
+	}
+
+	_, err := NewDataset(input).SortInt("foo").WithContext(ctx).Collect()
+
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected: %v\nactual: %v", context.DeadlineExceeded, err)
+	}
+}
+
+type contextKey string
+
+func TestDatasetWithContextBindsSources(t *testing.T) {
+	ctx := context.WithValue(context.Background(), contextKey("key"), "value")
+
+	var leftCtx, rightCtx, otherCtx context.Context
+	left := &BoundIterator{RecordIterator: RecordIterator{{"id": 1}}, bound: &leftCtx}
+	right := &BoundIterator{RecordIterator: RecordIterator{{"id": 1, "name": "John"}}, bound: &rightCtx}
+	other := &BoundIterator{RecordIterator: RecordIterator{{"id": 2}}, bound: &otherCtx}
+	expected := []Record{
+		{"id": 1, "name": "John"},
+		{"id": 2},
+	}
+
+	actual, err := NewDataset(left).
+		InnerJoin("id", "id", right).
+		Union(other).
+		WithContext(ctx).
+		Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected: %v\nactual: %v", expected, actual)
+	}
+	for i, bound := range []context.Context{leftCtx, rightCtx, otherCtx} {
+		if bound != ctx {
+			t.Fatalf("#%d: expected the source to be bound to the context", i)
+		}
+	}
+}
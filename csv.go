@@ -1,32 +1,189 @@
 package shred
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/csv"
+	"fmt"
 	"io"
+	"os"
+	"runtime"
 	"strconv"
+	"strings"
+	"sync"
 )
 
+type DuplicateColumnError struct {
+	Column string
+	Index  int
+}
+
+func (e *DuplicateColumnError) Error() string {
+	return fmt.Sprintf("shred: duplicate csv column %q at index %d", e.Column, e.Index)
+}
+
+// DuplicatePolicy decides how repeated column names are handled.
+type DuplicatePolicy int
+
+const (
+	DuplicateError DuplicatePolicy = iota
+	DuplicateRename
+	DuplicateKeepFirst
+	DuplicateKeepLast
+)
+
+// CsvDialect describes the format of a CSV input. The zero value is the
+// encoding/csv default: comma separated, strict field counts and UTF-8.
+type CsvDialect struct {
+	Delimiter        rune
+	Comment          rune
+	LazyQuotes       bool
+	TrimLeadingSpace bool
+	// VariableFields allows rows to have a different number of fields.
+	// Missing fields are left out of the record.
+	VariableFields bool
+	Encoding       CsvEncoding
+}
+
+var (
+	DialectTSV   = CsvDialect{Delimiter: '\t', LazyQuotes: true}
+	DialectExcel = CsvDialect{Delimiter: ','}
+	// DialectExcelUnicode matches Excel's "Unicode Text" export.
+	DialectExcelUnicode = CsvDialect{Delimiter: '\t', LazyQuotes: true, Encoding: EncodingUTF16}
+)
+
+func (d CsvDialect) newReader(input io.Reader) *csv.Reader {
+	reader := csv.NewReader(input)
+	if d.Delimiter != 0 {
+		reader.Comma = d.Delimiter
+	}
+	reader.Comment = d.Comment
+	reader.LazyQuotes = d.LazyQuotes
+	reader.TrimLeadingSpace = d.TrimLeadingSpace
+	if d.VariableFields {
+		reader.FieldsPerRecord = -1
+	}
+	return reader
+}
+
+type csvConfig struct {
+	dialect       CsvDialect
+	header        bool
+	columns       []string
+	duplicates    DuplicatePolicy
+	skipLines     int
+	commentPrefix string
+}
+
+type CsvOption func(*csvConfig)
+
+// CsvWithDialect sets the format of the input, e.g. DialectTSV.
+func CsvWithDialect(dialect CsvDialect) CsvOption {
+	return func(c *csvConfig) {
+		c.dialect = dialect
+	}
+}
+
+// CsvHeader treats the first row as a header and keys records by column name.
+func CsvHeader() CsvOption {
+	return func(c *csvConfig) {
+		c.header = true
+	}
+}
+
+// CsvColumns names the columns explicitly. Combined with CsvHeader, the header
+// row is discarded in favour of the given names.
+func CsvColumns(names ...string) CsvOption {
+	return func(c *csvConfig) {
+		c.columns = names
+	}
+}
+
+// CsvDuplicates sets the policy for repeated column names. The default fails
+// with a DuplicateColumnError. DuplicateRename suffixes repeats with _2, _3
+// and so on.
+func CsvDuplicates(policy DuplicatePolicy) CsvOption {
+	return func(c *csvConfig) {
+		c.duplicates = policy
+	}
+}
+
+// CsvSkipLines skips n raw lines, such as a banner, before parsing.
+func CsvSkipLines(n int) CsvOption {
+	return func(c *csvConfig) {
+		c.skipLines = n
+	}
+}
+
+// CsvSkipComments skips leading lines that start with prefix.
+func CsvSkipComments(prefix string) CsvOption {
+	return func(c *csvConfig) {
+		c.commentPrefix = prefix
+	}
+}
+
 type CsvIterator struct {
-	input  []byte
-	reader *csv.Reader
+	source  csvSource
+	config  csvConfig
+	input   io.ReadCloser
+	reader  *csv.Reader
+	columns []string
+	closed  bool
 }
 
-func NewCsvIterator(input []byte) *CsvIterator {
+func NewCsvIterator(input []byte, opts ...CsvOption) *CsvIterator {
+	return newCsvIterator(bytesSource(input), opts)
+}
+
+// NewCsvFileIterator streams the file at path. Each clone opens the file
+// again.
+func NewCsvFileIterator(path string, opts ...CsvOption) *CsvIterator {
+	return newCsvIterator(fileSource(path), opts)
+}
+
+// NewCsvSeekerIterator streams input from its current offset. Clones seek back
+// to that offset, so unless input is also an io.ReaderAt, only one clone may
+// be read at a time.
+func NewCsvSeekerIterator(input io.ReadSeeker, opts ...CsvOption) *CsvIterator {
+	return newCsvIterator(&seekerSource{input: input, offset: -1}, opts)
+}
+
+// NewCsvReaderIterator streams a one-shot input such as stdin. The input is
+// buffered to a temporary file as it is read so that clones can replay it.
+func NewCsvReaderIterator(input io.Reader, opts ...CsvOption) *CsvIterator {
+	return newCsvIterator(&spoolSource{input: input}, opts)
+}
+
+func newCsvIterator(source csvSource, opts []CsvOption) *CsvIterator {
+	var config csvConfig
+	for _, opt := range opts {
+		opt(&config)
+	}
+
 	return &CsvIterator{
-		input:  input,
-		reader: csv.NewReader(bytes.NewBuffer(input)),
+		source: source,
+		config: config,
 	}
 }
 
 func (c *CsvIterator) Clone() Iterator {
 	return &CsvIterator{
-		input:  c.input,
-		reader: csv.NewReader(bytes.NewBuffer(c.input)),
+		source: c.source.clone(),
+		config: c.config,
 	}
 }
 
 func (c *CsvIterator) Next() (Record, error) {
+	if c.closed {
+		return nil, nil
+	}
+
+	if c.reader == nil {
+		if err := c.start(); err != nil {
+			return nil, err
+		}
+	}
+
 	row, err := c.reader.Read()
 	if err == io.EOF {
 		return nil, nil
@@ -36,8 +193,297 @@ func (c *CsvIterator) Next() (Record, error) {
 
 	next := make(Record)
 	for i, val := range row {
-		next[strconv.Itoa(i)] = val
+		if i >= len(c.columns) {
+			next[strconv.Itoa(i)] = val
+		} else if c.columns[i] != "" {
+			next[c.columns[i]] = val
+		}
 	}
 
 	return next, nil
 }
+
+// Close releases the input. A closed iterator has no more records; clone it
+// to read the input again.
+func (c *CsvIterator) Close() error {
+	c.closed = true
+	if c.input == nil {
+		return nil
+	}
+
+	err := c.input.Close()
+	c.input = nil
+	return err
+}
+
+// start skips the leading lines and resolves the column names.
+func (c *CsvIterator) start() error {
+	var err error
+	if c.input, err = c.source.open(); err != nil {
+		return err
+	}
+
+	decoded := decodeInput(c.input, c.config.dialect.Encoding)
+	input, err := skipLeading(decoded, c.config.skipLines, c.config.commentPrefix)
+	if err != nil {
+		return err
+	}
+
+	c.reader = c.config.dialect.newReader(input)
+	names := c.config.columns
+	if c.config.header {
+		header, err := c.reader.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if names == nil {
+			names = header
+		}
+	}
+
+	c.columns, err = resolveColumns(names, c.config.duplicates)
+	return err
+}
+
+func skipLeading(r io.Reader, lines int, prefix string) (io.Reader, error) {
+	if lines == 0 && prefix == "" {
+		return r, nil
+	}
+
+	buffered := bufio.NewReader(r)
+	for i := 0; i < lines; i++ {
+		if _, err := buffered.ReadString('\n'); err == io.EOF {
+			return buffered, nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	for prefix != "" {
+		line, err := buffered.ReadString('\n')
+		if !strings.HasPrefix(line, prefix) {
+			// Put back the first line that isn't a comment.
+			return io.MultiReader(strings.NewReader(line), buffered), nil
+		} else if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	return buffered, nil
+}
+
+// resolveColumns applies the duplicate policy. An empty name means the field
+// is dropped.
+func resolveColumns(names []string, policy DuplicatePolicy) ([]string, error) {
+	if names == nil {
+		return nil, nil
+	}
+
+	columns := make([]string, len(names))
+	seen := make(map[string]int, len(names))
+	for i, name := range names {
+		if name == "" {
+			name = strconv.Itoa(i)
+		}
+
+		first, exists := seen[name]
+		if !exists {
+			seen[name] = i
+			columns[i] = name
+			continue
+		}
+
+		switch policy {
+		case DuplicateError:
+			return nil, &DuplicateColumnError{Column: name, Index: i}
+		case DuplicateKeepFirst:
+			continue
+		case DuplicateKeepLast:
+			columns[first] = ""
+			seen[name] = i
+			columns[i] = name
+		case DuplicateRename:
+			for n := 2; ; n++ {
+				renamed := fmt.Sprintf("%s_%d", name, n)
+				if _, taken := seen[renamed]; !taken && !contains(names[i+1:], renamed) {
+					seen[renamed] = i
+					columns[i] = renamed
+					break
+				}
+			}
+		}
+	}
+
+	return columns, nil
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// csvSource opens the input of a CsvIterator once per clone.
+type csvSource interface {
+	open() (io.ReadCloser, error)
+	clone() csvSource
+}
+
+type bytesSource []byte
+
+func (b bytesSource) open() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(b)), nil }
+func (b bytesSource) clone() csvSource             { return b }
+
+type fileSource string
+
+func (f fileSource) open() (io.ReadCloser, error) { return os.Open(string(f)) }
+func (f fileSource) clone() csvSource             { return f }
+
+type seekerSource struct {
+	mu     sync.Mutex
+	input  io.ReadSeeker
+	offset int64
+}
+
+func (s *seekerSource) open() (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The first open records the starting offset.
+	if s.offset < 0 {
+		offset, err := s.input.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		s.offset = offset
+	}
+
+	if at, ok := s.input.(io.ReaderAt); ok {
+		size, err := s.input.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(io.NewSectionReader(at, s.offset, size-s.offset)), nil
+	}
+
+	if _, err := s.input.Seek(s.offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return io.NopCloser(s.input), nil
+}
+
+func (s *seekerSource) clone() csvSource {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Record the offset before a clone has the chance to move it.
+	if s.offset < 0 {
+		s.offset, _ = s.input.Seek(0, io.SeekCurrent)
+	}
+	return s
+}
+
+// spoolSource copies a one-shot input to a temporary file on demand. Every
+// clone reads the file at its own offset and only pulls more of the input
+// when it reaches the end of what has been spooled so far.
+//
+// Clones that have not been read yet may still need the data, so the file
+// cannot be removed when one of them is closed. Instead it is unlinked as
+// soon as it is created and lives on through the open handle, which is
+// released once the iterators sharing it are garbage collected. Where open
+// files cannot be removed, the file is removed by the finalizer instead.
+type spoolSource struct {
+	mu    sync.Mutex
+	input io.Reader
+	file  *os.File
+	path  string
+	size  int64
+	done  bool
+	err   error
+}
+
+func (s *spoolSource) open() (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		file, err := os.CreateTemp("", "shred-csv-*")
+		if err != nil {
+			return nil, err
+		}
+
+		s.file = file
+		if err := os.Remove(file.Name()); err != nil {
+			s.path = file.Name()
+		}
+		runtime.SetFinalizer(s, (*spoolSource).cleanup)
+	}
+
+	return io.NopCloser(&spoolReader{source: s}), nil
+}
+
+func (s *spoolSource) clone() csvSource {
+	return s
+}
+
+func (s *spoolSource) cleanup() {
+	s.file.Close()
+	if s.path != "" {
+		os.Remove(s.path)
+	}
+}
+
+// readAt reads the spooled data at offset, spooling the next chunk of the
+// input when offset has caught up with it.
+func (s *spoolSource) readAt(p []byte, offset int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for offset >= s.size {
+		if s.err != nil {
+			return 0, s.err
+		} else if s.done {
+			return 0, io.EOF
+		}
+		s.fill()
+	}
+
+	if available := s.size - offset; int64(len(p)) > available {
+		p = p[:available]
+	}
+	return s.file.ReadAt(p, offset)
+}
+
+func (s *spoolSource) fill() {
+	buf := make([]byte, 32*1024)
+	n, err := s.input.Read(buf)
+	if _, writeErr := s.file.WriteAt(buf[:n], s.size); writeErr != nil {
+		s.err = writeErr
+		return
+	}
+	s.size += int64(n)
+
+	if err == io.EOF {
+		s.done = true
+	} else if err != nil {
+		s.err = err
+	}
+}
+
+type spoolReader struct {
+	source *spoolSource
+	offset int64
+}
+
+func (s *spoolReader) Read(p []byte) (int, error) {
+	n, err := s.source.readAt(p, s.offset)
+	s.offset += int64(n)
+	return n, err
+}
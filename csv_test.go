@@ -1,8 +1,16 @@
 package shred
 
 import (
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"io"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"unicode/utf16"
 )
 
 func TestCsvIterator(t *testing.T) {
@@ -20,3 +28,326 @@ func TestCsvIterator(t *testing.T) {
 		t.Fatalf("expected: %v\nactual: %v", expected, actual)
 	}
 }
+
+func TestCsvIteratorHeader(t *testing.T) {
+	input := []byte("# exported 2016-01-01\n# orders\nid,name,name\n1,John,Smith\n2,Jane,Doe\n")
+	tests := []struct {
+		opts     []CsvOption
+		expected []Record
+		err      error
+	}{
+		{
+			[]CsvOption{CsvSkipLines(2), CsvHeader()},
+			nil,
+			&DuplicateColumnError{Column: "name", Index: 2},
+		},
+		{
+			[]CsvOption{CsvSkipComments("#"), CsvHeader(), CsvDuplicates(DuplicateRename)},
+			[]Record{{"id": "1", "name": "John", "name_2": "Smith"}, {"id": "2", "name": "Jane", "name_2": "Doe"}},
+			nil,
+		},
+		{
+			[]CsvOption{CsvSkipComments("#"), CsvHeader(), CsvDuplicates(DuplicateKeepFirst)},
+			[]Record{{"id": "1", "name": "John"}, {"id": "2", "name": "Jane"}},
+			nil,
+		},
+		{
+			[]CsvOption{CsvSkipComments("#"), CsvHeader(), CsvDuplicates(DuplicateKeepLast)},
+			[]Record{{"id": "1", "name": "Smith"}, {"id": "2", "name": "Doe"}},
+			nil,
+		},
+		{
+			[]CsvOption{CsvSkipLines(2), CsvHeader(), CsvColumns("id", "first", "last")},
+			[]Record{{"id": "1", "first": "John", "last": "Smith"}, {"id": "2", "first": "Jane", "last": "Doe"}},
+			nil,
+		},
+		{
+			[]CsvOption{CsvSkipLines(3), CsvColumns("id", "first")},
+			[]Record{{"id": "1", "first": "John", "2": "Smith"}, {"id": "2", "first": "Jane", "2": "Doe"}},
+			nil,
+		},
+	}
+
+	for i, test := range tests {
+		iterator := NewCsvIterator(input, test.opts...)
+		for _, it := range []Iterator{iterator, iterator.Clone()} {
+			actual, err := NewDataset(it).Collect()
+
+			if !reflect.DeepEqual(test.err, err) {
+				t.Fatalf("#%d unexpected error: %v", i, err)
+			}
+			if !reflect.DeepEqual(test.expected, actual) {
+				t.Fatalf("#%d\nexpected: %v\nactual: %v", i, test.expected, actual)
+			}
+		}
+	}
+}
+
+func TestCsvIteratorHeaderOnly(t *testing.T) {
+	for _, input := range []string{"", "id,name\n", "# comment"} {
+		actual, err := NewDataset(NewCsvIterator([]byte(input), CsvSkipComments("#"), CsvHeader())).Collect()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(actual) != 0 {
+			t.Fatalf("unexpected: %v", actual)
+		}
+	}
+}
+
+// seeker hides the io.ReaderAt implementation of its reader.
+type seeker struct {
+	io.ReadSeeker
+}
+
+func TestCsvIteratorStreaming(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", dir)
+
+	input := "id,name\n1,John\n2,Jane\n"
+	expected := []Record{
+		{"id": "1", "name": "John"},
+		{"id": "2", "name": "Jane"},
+	}
+
+	path := filepath.Join(t.TempDir(), "users.csv")
+	if err := os.WriteFile(path, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	partial := strings.NewReader("banner\n" + input)
+	partial.Seek(7, io.SeekStart)
+
+	iterators := []*CsvIterator{
+		NewCsvFileIterator(path, CsvHeader()),
+		NewCsvSeekerIterator(strings.NewReader(input), CsvHeader()),
+		NewCsvSeekerIterator(seeker{partial}, CsvHeader()),
+		NewCsvReaderIterator(strings.NewReader(input), CsvHeader()),
+		NewCsvReaderIterator(io.MultiReader(strings.NewReader(input[:10]), strings.NewReader(input[10:])), CsvHeader()),
+	}
+
+	for i, iterator := range iterators {
+		clone := iterator.Clone()
+		for j, it := range []Iterator{iterator, clone, clone.Clone()} {
+			actual, err := NewDataset(it).Collect()
+			if err != nil {
+				t.Fatalf("#%d.%d: %v", i, j, err)
+			}
+			if !reflect.DeepEqual(expected, actual) {
+				t.Fatalf("#%d.%d\nexpected: %v\nactual: %v", i, j, expected, actual)
+			}
+		}
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Fatalf("expected temporary files to be removed, found %d", len(files))
+	}
+}
+
+func TestCsvReaderIteratorInterleaved(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", dir)
+
+	var builder strings.Builder
+	for i := 0; i < 10000; i++ {
+		builder.WriteString("some,longer,row,to,fill,several,chunks\n")
+	}
+
+	first := NewCsvReaderIterator(strings.NewReader(builder.String()))
+	second := first.Clone()
+	count := 0
+	for {
+		a, err := first.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := second.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(a, b) {
+			t.Fatalf("expected: %v\nactual: %v", a, b)
+		} else if a == nil {
+			break
+		}
+		count++
+	}
+
+	if count != 10000 {
+		t.Fatalf("expected 10000 records, found %d", count)
+	}
+
+	if err := first.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.(*CsvIterator).Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Closed clones don't stop later clones from replaying the input.
+	recs, err := NewDataset(first.Clone()).Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 10000 {
+		t.Fatalf("expected 10000 records, found %d", len(recs))
+	}
+
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Fatalf("expected the buffer to be removed, found %d files", len(files))
+	}
+}
+
+func TestCsvReaderIteratorPipeline(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", dir)
+
+	dataset := NewDataset(NewCsvReaderIterator(strings.NewReader("1\n2\n3\n")))
+	for i := 0; i < 2; i++ {
+		actual, err := dataset.Map(func(r Record) Record {
+			r["double"] = r.Int("0") * 2
+			return r
+		}).Collect()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(actual) != 3 || actual[2]["double"] != 6 {
+			t.Fatalf("#%d unexpected: %v", i, actual)
+		}
+
+		if files, _ := os.ReadDir(dir); len(files) != 0 {
+			t.Fatalf("#%d expected no spool file to remain, found %d", i, len(files))
+		}
+	}
+}
+
+func TestCsvIteratorNextAfterClose(t *testing.T) {
+	input := "1\n2\n3\n"
+	path := filepath.Join(t.TempDir(), "numbers.csv")
+	if err := os.WriteFile(path, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	iterators := []*CsvIterator{
+		NewCsvIterator([]byte(input)),
+		NewCsvFileIterator(path),
+		NewCsvSeekerIterator(strings.NewReader(input)),
+		NewCsvSeekerIterator(seeker{strings.NewReader(input)}),
+		NewCsvReaderIterator(strings.NewReader(input)),
+	}
+
+	for i, iterator := range iterators {
+		if next, err := iterator.Next(); err != nil || next == nil {
+			t.Fatalf("#%d expected a record, found %v, %v", i, next, err)
+		}
+		if err := iterator.Close(); err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+
+		next, err := iterator.Next()
+		if err != nil || next != nil {
+			t.Fatalf("#%d expected the end of the input, found %v, %v", i, next, err)
+		}
+	}
+}
+
+func TestCsvFileIteratorMissing(t *testing.T) {
+	_, err := NewDataset(NewCsvFileIterator(filepath.Join(t.TempDir(), "missing.csv"))).Collect()
+	if !os.IsNotExist(err) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func utf16Bytes(s string, bom []byte, order func([]byte, uint16)) []byte {
+	out := append([]byte{}, bom...)
+	for _, unit := range utf16.Encode([]rune(s)) {
+		var b [2]byte
+		order(b[:], unit)
+		out = append(out, b[:]...)
+	}
+	return out
+}
+
+func TestCsvIteratorDialects(t *testing.T) {
+	expected := []Record{
+		{"id": "1", "name": "Zoë", "note": "a \"quoted\" 😀"},
+		{"id": "2", "name": "Łukasz"},
+	}
+	latin1 := []Record{
+		{"id": "1", "name": "Zoë"},
+		{"id": "2", "name": "Renée"},
+	}
+
+	tests := []struct {
+		input    []byte
+		dialect  CsvDialect
+		expected []Record
+	}{
+		{
+			[]byte("id;name;note\n1;Zoë;\"a \"\"quoted\"\" 😀\"\n2;Łukasz\n"),
+			CsvDialect{Delimiter: ';', VariableFields: true},
+			expected,
+		},
+		{
+			[]byte("id| name| note\n# skipped\n1| Zoë| \"a \"\"quoted\"\" 😀\"\n2| Łukasz\n"),
+			CsvDialect{Delimiter: '|', Comment: '#', TrimLeadingSpace: true, VariableFields: true},
+			expected,
+		},
+		{
+			[]byte("id\tname\tnote\n1\tZoë\ta \"quoted\" 😀\n2\tŁukasz\n"),
+			CsvDialect{Delimiter: '\t', LazyQuotes: true, VariableFields: true},
+			expected,
+		},
+		{
+			append(append([]byte{}, bomUTF8...), "id,name\n1,Zoë\n2,Renée\n"...),
+			DialectExcel,
+			latin1,
+		},
+		{
+			utf16Bytes("id\tname\n1\tZoë\n2\tRenée\n", bomUTF16LE, binary.LittleEndian.PutUint16),
+			DialectExcelUnicode,
+			latin1,
+		},
+		{
+			utf16Bytes("id\tname\tnote\n1\tZoë\ta \"quoted\" 😀\n2\tŁukasz\n", bomUTF16BE, binary.BigEndian.PutUint16),
+			CsvDialect{Delimiter: '\t', LazyQuotes: true, VariableFields: true, Encoding: EncodingUTF16},
+			expected,
+		},
+		{
+			utf16Bytes("id,name\n1,Zoë\n2,Renée\n", nil, binary.BigEndian.PutUint16),
+			CsvDialect{Encoding: EncodingUTF16BE},
+			latin1,
+		},
+		{
+			[]byte("id,name\n1,Zo\xeb\n2,Ren\xe9e\n"),
+			CsvDialect{Encoding: EncodingLatin1},
+			latin1,
+		},
+	}
+
+	for i, test := range tests {
+		iterator := NewCsvReaderIterator(bytes.NewReader(test.input), CsvHeader(), CsvWithDialect(test.dialect))
+		actual, err := NewDataset(iterator).Collect()
+
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if !reflect.DeepEqual(test.expected, actual) {
+			t.Fatalf("#%d\nexpected: %v\nactual: %v", i, test.expected, actual)
+		}
+	}
+}
+
+func TestCsvIteratorStrictFields(t *testing.T) {
+	input := []byte("id;name\n1;John;Smith\n")
+
+	_, err := NewDataset(NewCsvIterator(input, CsvWithDialect(CsvDialect{Delimiter: ';'}))).Collect()
+	if _, ok := err.(*csv.ParseError); !ok {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -1,51 +1,164 @@
 package shred
 
 import (
+	"context"
 	"sort"
 )
 
 type Dataset struct {
-	input     Iterator
-	transform func(Iterator) (Record, error)
+	input       Iterator
+	newOperator func() operator
+	op          *operator
+	settings
+}
+
+// settings are carried over to every dataset derived from a dataset.
+type settings struct {
+	strictKeys   bool
+	memoryBudget int64
+	ctx          context.Context
+	// caches are the stores of every Cache or Persist the dataset reads
+	// from, so that Invalidate can reach them through any iterator.
+	caches []*cacheStore
+}
+
+// operator is the state of a transformation. Each dataset, including every
+// clone, builds its own operator the first time it is read, so that clones
+// can be read independently.
+type operator struct {
+	next  func(Iterator) (Record, error)
+	close func() error
 }
 
 func NewDataset(input Iterator) *Dataset {
-	return &Dataset{
+	d := &Dataset{
 		input: input,
 	}
+	return d.includeCaches(input)
 }
 
+// Transform derives a dataset whose records are produced by fn from the
+// records of d. fn is shared by every clone of the derived dataset, so it
+// should not hold state; use TransformFactory for stateful transformations.
 func (d *Dataset) Transform(fn func(Iterator) (Record, error)) *Dataset {
+	return d.operate(func() operator {
+		return operator{next: fn}
+	})
+}
+
+// TransformFactory is like Transform, but calls factory to build a separate
+// transformation for the derived dataset and for each of its clones.
+func (d *Dataset) TransformFactory(factory func() func(Iterator) (Record, error)) *Dataset {
+	return d.operate(func() operator {
+		return operator{next: factory()}
+	})
+}
+
+func (d *Dataset) operate(newOperator func() operator) *Dataset {
 	return &Dataset{
-		input:     d.Clone(),
-		transform: fn,
+		input:       d.Clone(),
+		newOperator: newOperator,
+		settings:    d.settings,
 	}
 }
 
 func (d *Dataset) Clone() Iterator {
 	return &Dataset{
-		input:     d.input.Clone(),
-		transform: d.transform,
+		input:       d.input.Clone(),
+		newOperator: d.newOperator,
+		settings:    d.settings,
+	}
+}
+
+// configure copies d so that its settings can be changed. Like a clone, the
+// copy reads from a clone of the input and builds its own operator.
+func (d *Dataset) configure() *Dataset {
+	return &Dataset{
+		input:       d.input.Clone(),
+		newOperator: d.newOperator,
+		settings:    d.settings,
+	}
+}
+
+// StrictKeys controls how the grouping and join operators derived from the
+// dataset compare key values. By default, numerically equal values match
+// regardless of their type, so that the string "1" from one source joins the
+// integer 1 from another. With strict keys, values must also have the same
+// type.
+func (d *Dataset) StrictKeys(strict bool) *Dataset {
+	clone := d.configure()
+	clone.strictKeys = strict
+	return clone
+}
+
+// MemoryBudget sets the approximate number of bytes of records that the
+// operators derived from the dataset hold in memory before spilling to disk.
+// A budget of zero restores DefaultMemoryBudget.
+func (d *Dataset) MemoryBudget(bytes int64) *Dataset {
+	clone := d.configure()
+	clone.memoryBudget = bytes
+	return clone
+}
+
+func (d *Dataset) budget() int64 {
+	if d.memoryBudget > 0 {
+		return d.memoryBudget
 	}
+
+	return DefaultMemoryBudget
+}
+
+func (d *Dataset) keyFunc() func(interface{}) interface{} {
+	if d.strictKeys {
+		return hashable
+	}
+
+	return normalizeKey
 }
 
 func (d *Dataset) Next() (Record, error) {
-	if d.transform == nil {
+	if err := d.checkContext(); err != nil {
+		return nil, err
+	}
+
+	if d.newOperator == nil {
 		return d.input.Next()
 	}
 
-	return d.transform(d.input)
+	if d.op == nil {
+		op := d.newOperator()
+		d.op = &op
+	}
+
+	return d.op.next(d.input)
 }
 
+// Close releases the resources held by the dataset and every transformation
+// and source it is derived from, such as open database rows or spill files,
+// without reading the remaining records. Sources are closed if they implement
+// io.Closer.
+func (d *Dataset) Close() error {
+	var err error
+	if d.op != nil && d.op.close != nil {
+		err = d.op.close()
+	}
+	if closeErr := closeIterator(d.input); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Collect reads every record of the dataset, then closes it.
 func (d *Dataset) Collect() ([]Record, error) {
 	records := []Record{}
 
 	for {
 		rec, err := d.Next()
 		if err != nil {
+			d.Close()
 			return nil, err
 		} else if rec == nil {
-			return records, nil
+			return records, d.Close()
 		}
 
 		records = append(records, rec)
@@ -80,167 +193,223 @@ func (d *Dataset) Map(fn func(Record) Record) *Dataset {
 	})
 }
 
-func (d *Dataset) Reduce(fn func(a, b Record) Record) *Dataset {
-	var acc Record
-	return d.Transform(func(iterator Iterator) (Record, error) {
-		for {
-			next, err := iterator.Next()
-			if err != nil {
+// Limit emits at most n records. The upstream iterators are closed, without
+// being drained, as soon as the last of them has been emitted.
+func (d *Dataset) Limit(n int) *Dataset {
+	return d.TransformFactory(func() func(Iterator) (Record, error) {
+		emitted, closed := 0, false
+		var closeErr error
+		return func(iterator Iterator) (Record, error) {
+			if emitted >= n {
+				if !closed {
+					closed = true
+					closeErr = closeIterator(iterator)
+				}
+				// A failed close is reported after the last record.
+				err := closeErr
+				closeErr = nil
 				return nil, err
-			} else if next == nil {
-				result := acc
-				acc = nil
-				return result, nil
-			} else if acc == nil {
-				acc = next
-				continue
 			}
 
-			acc = fn(acc, next)
+			next, err := iterator.Next()
+			if err != nil || next == nil {
+				return next, err
+			}
+
+			if emitted++; emitted == n {
+				closed = true
+				closeErr = closeIterator(iterator)
+			}
+			return next, nil
 		}
 	})
 }
 
-func (d *Dataset) ReduceByKey(key string, fn func(a, b Record) Record) *Dataset {
-	var acc []Record
-	done := false
-
-	return d.Transform(func(iterator Iterator) (Record, error) {
-		if !done {
-			keyed := map[interface{}]Record{}
+// Skip drops the first n records.
+func (d *Dataset) Skip(n int) *Dataset {
+	return d.TransformFactory(func() func(Iterator) (Record, error) {
+		skipped := 0
+		return func(iterator Iterator) (Record, error) {
 			for {
 				next, err := iterator.Next()
-				if err != nil {
-					return nil, err
-				} else if next == nil {
-					break
-				}
-
-				reduceVal := next.Get(key)
-				if a, exists := keyed[reduceVal]; !exists {
-					keyed[reduceVal] = next
-				} else {
-					keyed[reduceVal] = fn(a, next)
+				if err != nil || next == nil {
+					return next, err
+				} else if skipped >= n {
+					return next, nil
 				}
+				skipped++
 			}
-
-			for _, rec := range keyed {
-				acc = append(acc, rec)
-			}
-			done = true
-		}
-
-		if len(acc) == 0 {
-			return nil, nil
 		}
-
-		next := acc[0]
-		acc = acc[1:]
-		return next, nil
 	})
 }
 
-func (d *Dataset) Sort(fn func([]Record) sort.Interface) *Dataset {
-	var recs []Record
-	done := false
+// TakeWhile emits records until fn returns false for one of them, at which
+// point the upstream iterators are closed without being drained.
+func (d *Dataset) TakeWhile(fn func(Record) bool) *Dataset {
+	return d.TransformFactory(func() func(Iterator) (Record, error) {
+		done := false
+		return func(iterator Iterator) (Record, error) {
+			if done {
+				return nil, nil
+			}
 
-	return d.Transform(func(iterator Iterator) (Record, error) {
-		if !done {
-			var err error
-			if recs, err = NewDataset(iterator).Collect(); err != nil {
-				return nil, err
+			next, err := iterator.Next()
+			if err != nil || next == nil {
+				return next, err
+			} else if fn(next) {
+				return next, nil
 			}
 
-			sort.Sort(fn(recs))
 			done = true
+			return nil, closeIterator(iterator)
 		}
+	})
+}
 
-		if len(recs) == 0 {
-			return nil, nil
+// DropWhile drops records until fn returns false for one of them, then emits
+// that record and every record after it.
+func (d *Dataset) DropWhile(fn func(Record) bool) *Dataset {
+	return d.TransformFactory(func() func(Iterator) (Record, error) {
+		dropping := true
+		return func(iterator Iterator) (Record, error) {
+			for {
+				next, err := iterator.Next()
+				if err != nil || next == nil || !dropping {
+					return next, err
+				} else if !fn(next) {
+					dropping = false
+					return next, nil
+				}
+			}
 		}
-
-		next := recs[0]
-		recs = recs[1:]
-		return next, nil
 	})
 }
 
-func (d *Dataset) SortInt(key string) *Dataset {
-	return d.Sort(func(recs []Record) sort.Interface {
-		return intSorter{records: recs, key: key}
+func (d *Dataset) Reduce(fn func(a, b Record) Record) *Dataset {
+	return d.TransformFactory(func() func(Iterator) (Record, error) {
+		var acc Record
+		return func(iterator Iterator) (Record, error) {
+			for {
+				next, err := iterator.Next()
+				if err != nil {
+					return nil, err
+				} else if next == nil {
+					result := acc
+					acc = nil
+					return result, nil
+				} else if acc == nil {
+					acc = next
+					continue
+				}
+
+				acc = fn(acc, next)
+			}
+		}
 	})
 }
 
-func (d *Dataset) SortString(key string) *Dataset {
-	return d.Sort(func(recs []Record) sort.Interface {
-		return stringSorter{records: recs, key: key}
-	})
+func (d *Dataset) ReduceByKey(key string, fn func(a, b Record) Record) *Dataset {
+	return d.ReduceByKeys([]string{key}, fn)
 }
 
-func (d *Dataset) Union(other Iterator) *Dataset {
-	doneFirst := false
+// ReduceByKeys reduces the records that share the same values for keys with
+// fn. Once the partial results exceed the memory budget, they are partitioned
+// by key to temporary files and each partition is reduced independently.
+func (d *Dataset) ReduceByKeys(keys []string, fn func(a, b Record) Record) *Dataset {
+	keyFn := d.keyFunc()
+	budget := d.budget()
+
+	return d.operate(func() operator {
+		var reduced Iterator
+		return operator{
+			next: func(iterator Iterator) (Record, error) {
+				if reduced == nil {
+					var err error
+					if reduced, err = hashReduce(iterator, keys, keyFn, fn, budget, 0); err != nil {
+						return nil, err
+					}
+				}
 
-	return d.Transform(func(iterator Iterator) (Record, error) {
-		if !doneFirst {
-			next, err := iterator.Next()
-			if err != nil {
-				return nil, err
-			} else if next != nil {
-				return next, nil
-			}
+				return reduced.Next()
+			},
+			close: func() error {
+				return closeIterator(reduced)
+			},
 		}
+	})
+}
 
-		next, err := other.Next()
-		if err != nil {
-			return nil, err
-		} else if next == nil {
-			return nil, nil
+// Sort orders the records of the dataset with the sort.Interface returned by
+// fn. Records are sorted in memory until they exceed the memory budget, after
+// which sorted runs are spilled to temporary files and merged. The sort is
+// stable.
+func (d *Dataset) Sort(fn func([]Record) sort.Interface) *Dataset {
+	budget := d.budget()
+
+	return d.operate(func() operator {
+		var sorted Iterator
+		return operator{
+			next: func(iterator Iterator) (Record, error) {
+				if sorted == nil {
+					var err error
+					if sorted, err = externalSort(iterator, fn, budget); err != nil {
+						return nil, err
+					}
+				}
+
+				return sorted.Next()
+			},
+			close: func() error {
+				return closeIterator(sorted)
+			},
 		}
+	})
+}
 
-		return next, nil
+func (d *Dataset) SortInt(keys ...string) *Dataset {
+	return d.Sort(func(recs []Record) sort.Interface {
+		return intSorter{records: recs, keys: keys}
 	})
 }
 
-func (d *Dataset) InnerJoin(lKey, rKey string, right Iterator) *Dataset {
-	var (
-		rightMap     map[interface{}][]Record
-		currentLeft  Record
-		currentRight []Record
-	)
+func (d *Dataset) SortString(keys ...string) *Dataset {
+	return d.Sort(func(recs []Record) sort.Interface {
+		return stringSorter{records: recs, keys: keys}
+	})
+}
 
-	return d.Transform(func(iterator Iterator) (Record, error) {
-		if rightMap == nil {
-			rightMap = make(map[interface{}][]Record)
-			if _, err := NewDataset(right).Filter(func(r Record) bool {
-				val := r.Get(rKey)
-				rightMap[val] = append(rightMap[val], r)
-				return false
-			}).Collect(); err != nil {
-				return nil, err
-			}
-		}
+// Union emits the records of d followed by the records of other. Each clone of
+// the derived dataset reads its own clone of other.
+func (d *Dataset) Union(other Iterator) *Dataset {
+	return d.operate(func() operator {
+		var second Iterator
+		doneFirst := false
+		return operator{
+			next: func(iterator Iterator) (Record, error) {
+				if !doneFirst {
+					next, err := iterator.Next()
+					if err != nil || next != nil {
+						return next, err
+					}
+					doneFirst = true
+				}
 
-		for len(currentRight) == 0 {
-			next, err := iterator.Next()
-			if err != nil {
-				return nil, err
-			} else if next == nil {
-				return nil, nil
-			}
+				if second == nil {
+					second = bindContext(other.Clone(), contextOf(iterator))
+				}
 
-			currentLeft = next
-			currentRight = rightMap[currentLeft.Get(lKey)]
+				return second.Next()
+			},
+			close: func() error {
+				return closeIterator(second)
+			},
 		}
-
-		next := currentLeft.Merge(currentRight[0])
-		currentRight = currentRight[1:]
-		return next, nil
-	})
+	}).includeCaches(other)
 }
 
 type intSorter struct {
 	records []Record
-	key     string
+	keys    []string
 }
 
 func (i intSorter) Len() int {
@@ -248,7 +417,12 @@ func (i intSorter) Len() int {
 }
 
 func (i intSorter) Less(a, b int) bool {
-	return i.records[a].Int(i.key) < i.records[b].Int(i.key)
+	for _, key := range i.keys {
+		if x, y := i.records[a].Int(key), i.records[b].Int(key); x != y {
+			return x < y
+		}
+	}
+	return false
 }
 
 func (i intSorter) Swap(a, b int) {
@@ -257,7 +431,7 @@ func (i intSorter) Swap(a, b int) {
 
 type stringSorter struct {
 	records []Record
-	key     string
+	keys    []string
 }
 
 func (s stringSorter) Len() int {
@@ -265,7 +439,12 @@ func (s stringSorter) Len() int {
 }
 
 func (s stringSorter) Less(a, b int) bool {
-	return s.records[a].String(s.key) < s.records[b].String(s.key)
+	for _, key := range s.keys {
+		if x, y := s.records[a].String(key), s.records[b].String(key); x != y {
+			return x < y
+		}
+	}
+	return false
 }
 
 func (s stringSorter) Swap(a, b int) {
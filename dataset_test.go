@@ -1,6 +1,8 @@
 package shred
 
 import (
+	"context"
+	"os"
 	"reflect"
 	"testing"
 )
@@ -265,3 +267,449 @@ func TestDatasetErrorPropagation(t *testing.T) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 }
+
+func TestDatasetReduceByKeys(t *testing.T) {
+	input := &RecordIterator{
+		{"user_id": 1, "order_id": 1, "total": 1},
+		{"user_id": 1, "order_id": 2, "total": 2},
+		{"user_id": 1, "order_id": 1, "total": 4},
+		{"user_id": 2, "order_id": 1, "total": 8},
+		{"user_id": "1", "order_id": 1, "total": 16},
+	}
+	expected := []Record{
+		{"user_id": 1, "order_id": 2, "total": 2},
+		{"user_id": 1, "order_id": 1, "total": 5},
+		{"user_id": 2, "order_id": 1, "total": 8},
+		{"user_id": "1", "order_id": 1, "total": 16},
+	}
+
+	actual, err := NewDataset(input).StrictKeys(true).ReduceByKeys([]string{"user_id", "order_id"}, func(a, b Record) Record {
+		return a.Set("total", a.Int("total")+b.Int("total"))
+	}).SortInt("total").Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected: %v\nactual: %v", expected, actual)
+	}
+}
+
+func TestDatasetReduceByNormalizedKey(t *testing.T) {
+	input := &RecordIterator{
+		{"id": 1, "n": 1},
+		{"id": "1", "n": 2},
+		{"id": 1.0, "n": 4},
+		{"id": int64(1), "n": 8},
+		{"id": []byte("1"), "n": 16},
+		{"id": "1.5", "n": 32},
+		{"id": float32(1.5), "n": 64},
+		{"id": "foo", "n": 128},
+	}
+	expected := []Record{
+		{"id": 1, "n": 31},
+		{"id": "1.5", "n": 96},
+		{"id": "foo", "n": 128},
+	}
+
+	actual, err := NewDataset(input).ReduceByKey("id", func(a, b Record) Record {
+		return a.Set("n", a.Int("n")+b.Int("n"))
+	}).SortInt("n").Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected: %v\nactual: %v", expected, actual)
+	}
+}
+
+func TestDatasetReduceByUncomparableKey(t *testing.T) {
+	input := &RecordIterator{
+		{"tags": []interface{}{"a", "b"}, "n": 1},
+		{"tags": []interface{}{"a", "b"}, "n": 2},
+		{"tags": []interface{}{"a"}, "n": 4},
+	}
+	expected := []Record{
+		{"tags": []interface{}{"a", "b"}, "n": 3},
+		{"tags": []interface{}{"a"}, "n": 4},
+	}
+
+	actual, err := NewDataset(input).ReduceByKey("tags", func(a, b Record) Record {
+		return a.Set("n", a.Int("n")+b.Int("n"))
+	}).SortInt("n").Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected: %v\nactual: %v", expected, actual)
+	}
+}
+
+func TestDatasetSortIntMultipleKeys(t *testing.T) {
+	input := &RecordIterator{
+		{"a": 2, "b": 1},
+		{"a": 1, "b": 2},
+		{"a": 2, "b": 0},
+		{"a": 1, "b": 1},
+	}
+	expected := []Record{
+		{"a": 1, "b": 1},
+		{"a": 1, "b": 2},
+		{"a": 2, "b": 0},
+		{"a": 2, "b": 1},
+	}
+
+	actual, err := NewDataset(input).SortInt("a", "b").Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected: %v\nactual: %v", expected, actual)
+	}
+}
+
+func TestDatasetInnerJoinKeys(t *testing.T) {
+	left := &RecordIterator{
+		{"user_id": 1, "order_id": 1, "total_price": 25},
+		{"user_id": 1, "order_id": 2, "total_price": 55},
+		{"user_id": 2, "order_id": 1, "total_price": 11},
+	}
+	right := &RecordIterator{
+		{"uid": 1, "oid": 2, "item": "book"},
+		{"uid": 2, "oid": 1, "item": "pen"},
+		{"uid": 2, "oid": 1, "item": "ink"},
+		{"uid": 2, "oid": 2, "item": "lamp"},
+	}
+	expected := []Record{
+		{"user_id": 1, "order_id": 2, "total_price": 55, "uid": 1, "oid": 2, "item": "book"},
+		{"user_id": 2, "order_id": 1, "total_price": 11, "uid": 2, "oid": 1, "item": "pen"},
+		{"user_id": 2, "order_id": 1, "total_price": 11, "uid": 2, "oid": 1, "item": "ink"},
+	}
+
+	actual, err := NewDataset(left).InnerJoinKeys([]string{"user_id", "order_id"}, []string{"uid", "oid"}, right).Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected: %v\nactual: %v", expected, actual)
+	}
+
+	_, err = NewDataset(left).InnerJoinKeys([]string{"user_id"}, []string{"uid", "oid"}, right).Collect()
+	if err != ErrJoinKeys {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestDatasetLimit(t *testing.T) {
+	input := NewClosingIterator(Record{"foo": 1}, Record{"foo": 2}, Record{"foo": 3}, Record{"foo": 4})
+	expected := []Record{
+		{"foo": 1},
+		{"foo": 2},
+	}
+
+	dataset := NewDataset(input).Limit(2)
+	actual := []Record{}
+	for i := 0; i < 2; i++ {
+		next, err := dataset.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual = append(actual, next)
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected: %v\nactual: %v", expected, actual)
+	}
+	if input.stats.next != 2 || input.stats.closed == 0 {
+		t.Fatalf("expected 2 reads and a close, found %d reads and %d closes", input.stats.next, input.stats.closed)
+	}
+
+	next, err := dataset.Next()
+	if err != nil || next != nil {
+		t.Fatalf("expected the end of the dataset, found %v, %v", next, err)
+	}
+}
+
+func TestDatasetSkip(t *testing.T) {
+	input := &RecordIterator{
+		{"foo": 1},
+		{"foo": 2},
+		{"foo": 3},
+	}
+	expected := []Record{
+		{"foo": 3},
+	}
+
+	actual, err := NewDataset(input).Skip(2).Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected: %v\nactual: %v", expected, actual)
+	}
+}
+
+func TestDatasetTakeWhile(t *testing.T) {
+	input := NewClosingIterator(Record{"foo": 1}, Record{"foo": 2}, Record{"foo": 3}, Record{"foo": 1})
+	expected := []Record{
+		{"foo": 1},
+		{"foo": 2},
+	}
+
+	actual, err := NewDataset(input).TakeWhile(func(r Record) bool {
+		return r.Int("foo") < 3
+	}).Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected: %v\nactual: %v", expected, actual)
+	}
+	if input.stats.next != 3 || input.stats.closed == 0 {
+		t.Fatalf("expected 3 reads and a close, found %d reads and %d closes", input.stats.next, input.stats.closed)
+	}
+}
+
+func TestDatasetDropWhile(t *testing.T) {
+	input := &RecordIterator{
+		{"foo": 1},
+		{"foo": 2},
+		{"foo": 3},
+		{"foo": 1},
+	}
+	expected := []Record{
+		{"foo": 3},
+		{"foo": 1},
+	}
+
+	actual, err := NewDataset(input).DropWhile(func(r Record) bool {
+		return r.Int("foo") < 3
+	}).Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected: %v\nactual: %v", expected, actual)
+	}
+}
+
+func TestDatasetCollectCloses(t *testing.T) {
+	left := NewClosingIterator(Record{"id": 1}, Record{"id": 2})
+	right := NewClosingIterator(Record{"id": 2, "name": "Jane"})
+	other := NewClosingIterator(Record{"id": 3})
+
+	_, err := NewDataset(left).
+		InnerJoin("id", "id", right).
+		Union(other).
+		SortInt("id").
+		Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, input := range []*ClosingIterator{left, right, other} {
+		if input.stats.closed == 0 {
+			t.Fatalf("#%d: expected the input to be closed", i)
+		}
+	}
+}
+
+func TestDatasetCollectClosesOnError(t *testing.T) {
+	input := NewClosingIterator(Record{"id": 1})
+
+	_, err := NewDataset(input).Union(&FailingIterator{}).Collect()
+
+	if err != ErrFailingIterator {
+		t.Fatalf("expected: %v\nactual: %v", ErrFailingIterator, err)
+	}
+	if input.stats.closed == 0 {
+		t.Fatal("expected the input to be closed")
+	}
+}
+
+func TestDatasetCloseAbandoned(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", dir)
+
+	records := []Record{}
+	for i := 0; i < 100; i++ {
+		records = append(records, Record{"id": 100 - i})
+	}
+	input := NewClosingIterator(records...)
+
+	dataset := NewDataset(input).MemoryBudget(1000).SortInt("id")
+	if _, err := dataset.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if err := dataset.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if input.stats.closed == 0 {
+		t.Fatal("expected the input to be closed")
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Fatalf("expected spill files to be removed, found %d", len(files))
+	}
+}
+
+func TestDatasetClonesAreIndependent(t *testing.T) {
+	input := func() *RecordIterator {
+		return &RecordIterator{
+			{"foo": 3, "bar": "c"},
+			{"foo": 1, "bar": "a"},
+			{"foo": 2, "bar": "b"},
+			{"foo": 1, "bar": "d"},
+		}
+	}
+	right := &RecordIterator{
+		{"id": 1, "name": "one"},
+		{"id": 2, "name": "two"},
+	}
+	sum := func(a, b Record) Record {
+		return Record{"foo": a.Int("foo"), "n": a.IntOr("n", 1) + b.IntOr("n", 1)}
+	}
+	identity := func(r Record) Record {
+		return r
+	}
+	small := func(r Record) bool {
+		return r.Int("foo") > 1
+	}
+
+	tests := map[string]func(*Dataset) *Dataset{
+		"Reduce":      func(d *Dataset) *Dataset { return d.Reduce(sum) },
+		"ReduceByKey": func(d *Dataset) *Dataset { return d.ReduceByKey("foo", sum).SortInt("foo") },
+		"SortInt":     func(d *Dataset) *Dataset { return d.SortInt("foo") },
+		"SortSpill":   func(d *Dataset) *Dataset { return d.MemoryBudget(1).SortString("bar") },
+		"OrderBy":     func(d *Dataset) *Dataset { return d.OrderBy(Desc("foo"), Asc("bar")) },
+		"TopN":        func(d *Dataset) *Dataset { return d.TopN(2, Asc("foo")) },
+		"Limit":       func(d *Dataset) *Dataset { return d.Limit(3) },
+		"Skip":        func(d *Dataset) *Dataset { return d.Skip(2) },
+		"TakeWhile":   func(d *Dataset) *Dataset { return d.TakeWhile(small) },
+		"DropWhile":   func(d *Dataset) *Dataset { return d.DropWhile(small) },
+		"Union":       func(d *Dataset) *Dataset { return d.Union(right) },
+		"Join":        func(d *Dataset) *Dataset { return d.LeftJoin("foo", "id", right) },
+		"GraceJoin":   func(d *Dataset) *Dataset { return d.MemoryBudget(1).InnerJoin("foo", "id", right).SortString("bar") },
+		"MergeJoin": func(d *Dataset) *Dataset {
+			return d.SortInt("foo").MergeJoin(JoinFull, []string{"foo"}, []string{"id"}, right)
+		},
+		"ParallelMap":    func(d *Dataset) *Dataset { return d.ParallelMap(2, identity) },
+		"ParallelReduce": func(d *Dataset) *Dataset { return d.ParallelReduceByKey(2, "foo", sum).SortInt("foo") },
+		"Aggregate":      func(d *Dataset) *Dataset { return d.GroupBy("foo").Aggregate(Count(""), Collect("bar")).SortInt("foo") },
+		"Pipelined":      func(d *Dataset) *Dataset { return d.Map(identity).Limit(3).Pipelined(1) },
+	}
+
+	for name, op := range tests {
+		expected, err := op(NewDataset(input())).Collect()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		dataset := op(NewDataset(input()))
+		clones := []Iterator{dataset, dataset.Clone(), dataset.Clone()}
+		actual := make([][]Record, len(clones))
+		for done := 0; done < len(clones); {
+			done = 0
+			for i, clone := range clones {
+				next, err := clone.Next()
+				if err != nil {
+					t.Fatalf("%s #%d: %v", name, i, err)
+				} else if next == nil {
+					done++
+				} else {
+					actual[i] = append(actual[i], next)
+				}
+			}
+		}
+
+		for i := range clones {
+			if len(expected) == 0 && len(actual[i]) == 0 {
+				continue
+			}
+			if !reflect.DeepEqual(expected, actual[i]) {
+				t.Fatalf("%s #%d\nexpected: %v\nactual: %v", name, i, expected, actual[i])
+			}
+		}
+	}
+}
+
+func TestDatasetTransformFactory(t *testing.T) {
+	input := &RecordIterator{
+		{"foo": "a"},
+		{"foo": "b"},
+	}
+	expected := []Record{
+		{"foo": "a", "n": 1},
+		{"foo": "b", "n": 2},
+	}
+
+	dataset := NewDataset(input).TransformFactory(func() func(Iterator) (Record, error) {
+		n := 0
+		return func(iterator Iterator) (Record, error) {
+			next, err := iterator.Next()
+			if err != nil || next == nil {
+				return next, err
+			}
+
+			n++
+			return next.Clone().Set("n", n), nil
+		}
+	})
+	clone := dataset.Clone()
+
+	for i, iterator := range []Iterator{dataset, clone} {
+		actual, err := NewDataset(iterator).Collect()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(expected, actual) {
+			t.Fatalf("#%d\nexpected: %v\nactual: %v", i, expected, actual)
+		}
+	}
+}
+
+func TestDatasetSettingsCopiesAreIndependent(t *testing.T) {
+	expected := []Record{{"a": "1"}, {"a": "2"}, {"a": "3"}}
+	copies := []func(d *Dataset) *Dataset{
+		func(d *Dataset) *Dataset { return d.StrictKeys(true) },
+		func(d *Dataset) *Dataset { return d.MemoryBudget(1 << 20) },
+		func(d *Dataset) *Dataset { return d.WithContext(context.Background()) },
+		func(d *Dataset) *Dataset { return d.Pipelined(1) },
+	}
+
+	for i, copy := range copies {
+		for _, d := range []*Dataset{
+			NewDataset(NewCsvIterator([]byte("a\n1\n2\n3\n"), CsvHeader())),
+			NewDataset(NewCsvIterator([]byte("a\n1\n2\n3\n"), CsvHeader())).Map(func(r Record) Record { return r }),
+		} {
+			// Reading the receiver must not move the copy forward.
+			if _, err := d.Next(); err != nil {
+				t.Fatalf("#%d: %v", i, err)
+			}
+
+			actual, err := copy(d).Collect()
+			if err != nil {
+				t.Fatalf("#%d: %v", i, err)
+			}
+			if !reflect.DeepEqual(expected, actual) {
+				t.Fatalf("#%d\nexpected: %v\nactual: %v", i, expected, actual)
+			}
+
+			if next, err := d.Next(); err != nil || !reflect.DeepEqual(expected[1], next) {
+				t.Fatalf("#%d\nexpected: %v\nactual: %v %v", i, expected[1], next, err)
+			}
+		}
+	}
+}
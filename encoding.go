@@ -0,0 +1,135 @@
+package shred
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// CsvEncoding is the character encoding of a CSV input. Inputs are decoded to
+// UTF-8 before parsing.
+type CsvEncoding int
+
+const (
+	// EncodingUTF8 is the default. A leading byte order mark is dropped.
+	EncodingUTF8 CsvEncoding = iota
+	// EncodingUTF16 detects the byte order from the byte order mark and
+	// falls back to little endian.
+	EncodingUTF16
+	EncodingUTF16LE
+	EncodingUTF16BE
+	EncodingLatin1
+)
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+func decodeInput(r io.Reader, encoding CsvEncoding) io.Reader {
+	buffered := bufio.NewReader(r)
+	bom, _ := buffered.Peek(3)
+
+	switch encoding {
+	case EncodingUTF16, EncodingUTF16LE, EncodingUTF16BE:
+		var order binary.ByteOrder = binary.LittleEndian
+		if encoding == EncodingUTF16BE {
+			order = binary.BigEndian
+		}
+
+		if bytes.HasPrefix(bom, bomUTF16LE) && encoding != EncodingUTF16BE {
+			buffered.Discard(2)
+		} else if bytes.HasPrefix(bom, bomUTF16BE) && encoding != EncodingUTF16LE {
+			order = binary.BigEndian
+			buffered.Discard(2)
+		}
+		return &utf16Reader{input: buffered, order: order}
+	case EncodingLatin1:
+		return &latin1Reader{input: buffered}
+	}
+
+	if bytes.HasPrefix(bom, bomUTF8) {
+		buffered.Discard(3)
+	}
+	return buffered
+}
+
+// utf16Reader decodes UTF-16 to UTF-8. Unpaired surrogates become U+FFFD.
+type utf16Reader struct {
+	input *bufio.Reader
+	order binary.ByteOrder
+	out   []byte
+	err   error
+}
+
+func (u *utf16Reader) Read(p []byte) (int, error) {
+	for len(u.out) == 0 && u.err == nil {
+		u.decode()
+	}
+
+	if len(u.out) == 0 {
+		return 0, u.err
+	}
+
+	n := copy(p, u.out)
+	u.out = u.out[n:]
+	return n, nil
+}
+
+func (u *utf16Reader) decode() {
+	var unit [2]byte
+	for len(u.out) < 4096 {
+		if _, err := io.ReadFull(u.input, unit[:]); err != nil {
+			u.err = err
+			return
+		}
+
+		r := rune(u.order.Uint16(unit[:]))
+		if utf16.IsSurrogate(r) {
+			next, err := u.input.Peek(2)
+			if err == nil {
+				r = utf16.DecodeRune(r, rune(u.order.Uint16(next)))
+			} else {
+				r = utf8.RuneError
+			}
+			if r != utf8.RuneError {
+				u.input.Discard(2)
+			}
+		}
+		u.out = utf8.AppendRune(u.out, r)
+
+		// Don't block for more input when some is ready.
+		if u.input.Buffered() < 2 {
+			return
+		}
+	}
+}
+
+// latin1Reader decodes ISO-8859-1, where every byte is its own code point.
+type latin1Reader struct {
+	input *bufio.Reader
+	out   []byte
+}
+
+func (l *latin1Reader) Read(p []byte) (int, error) {
+	if len(l.out) == 0 {
+		b, err := l.input.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+
+		l.out = utf8.AppendRune(l.out[:0], rune(b))
+		for l.input.Buffered() > 0 && len(l.out) < 4096 {
+			b, _ = l.input.ReadByte()
+			l.out = utf8.AppendRune(l.out, rune(b))
+		}
+	}
+
+	n := copy(p, l.out)
+	l.out = l.out[n:]
+	return n, nil
+}
@@ -0,0 +1,75 @@
+package shred
+
+import (
+	"runtime/debug"
+	"sync"
+)
+
+// result is a record or an error produced on a goroutine. seq and keep are
+// only used by parallelIterator, to restore the input order and to filter.
+type result struct {
+	seq  int
+	rec  Record
+	keep bool
+	err  error
+}
+
+// goroutines runs the goroutines behind an iterator, which send their results
+// on a channel that is closed once all of them have exited.
+type goroutines struct {
+	results chan result
+	done    chan struct{}
+	once    sync.Once
+	wg      sync.WaitGroup
+}
+
+func newGoroutines(buffer int) *goroutines {
+	return &goroutines{
+		results: make(chan result, buffer),
+		done:    make(chan struct{}),
+	}
+}
+
+// start runs fn on a new goroutine. A panic in fn is sent as a PanicError.
+func (g *goroutines) start(fn func()) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		defer func() {
+			if v := recover(); v != nil {
+				g.send(result{err: &PanicError{Value: v, Stack: debug.Stack()}})
+			}
+		}()
+
+		fn()
+	}()
+}
+
+// closeWhenDone closes the results once every started goroutine has exited.
+// It must be called after the last call to start.
+func (g *goroutines) closeWhenDone() {
+	go func() {
+		g.wg.Wait()
+		close(g.results)
+	}()
+}
+
+// send delivers r unless the goroutines are being stopped, in which case it
+// reports false and the caller should exit.
+func (g *goroutines) send(r result) bool {
+	select {
+	case g.results <- r:
+		return true
+	case <-g.done:
+		return false
+	}
+}
+
+// stop signals the goroutines to exit and waits until they have, so that
+// their inputs are no longer in use.
+func (g *goroutines) stop() {
+	g.once.Do(func() {
+		close(g.done)
+	})
+	g.wg.Wait()
+}
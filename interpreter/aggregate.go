@@ -0,0 +1,110 @@
+package interpreter
+
+import (
+	"strings"
+
+	"github.com/JamesOwenHall/shred"
+)
+
+type aggregateFunc struct {
+	args  int
+	build func(col string, call *Call) (shred.Aggregator, error)
+}
+
+var aggregateFuncs = map[string]aggregateFunc{
+	"COUNT":          {args: 1, build: column(shred.Count)},
+	"SUM":            {args: 1, build: column(shred.Sum)},
+	"MIN":            {args: 1, build: column(shred.Min)},
+	"MAX":            {args: 1, build: column(shred.Max)},
+	"AVG":            {args: 1, build: column(shred.Avg)},
+	"COUNT_DISTINCT": {args: 1, build: column(shred.CountDistinct)},
+	"FIRST":          {args: 1, build: column(shred.First)},
+	"LAST":           {args: 1, build: column(shred.Last)},
+	"COLLECT":        {args: 1, build: column(shred.Collect)},
+	"PERCENTILE":     {args: 2, build: percentile},
+}
+
+func column(fn func(string) shred.Aggregator) func(string, *Call) (shred.Aggregator, error) {
+	return func(col string, _ *Call) (shred.Aggregator, error) {
+		return fn(col), nil
+	}
+}
+
+func percentile(col string, call *Call) (shred.Aggregator, error) {
+	lit, ok := call.Args[1].(*Literal)
+	if ok {
+		var p float64
+		switch val := lit.Val.(type) {
+		case int:
+			p = float64(val)
+		case float64:
+			p = val
+		default:
+			ok = false
+		}
+
+		if ok && 0 <= p && p <= 1 {
+			return shred.Percentile(col, p), nil
+		}
+	}
+
+	return nil, planError(call.Args[1].Position(), "%s expects a percentile between 0 and 1", call.Name)
+}
+
+func isAggregate(call *Call) bool {
+	_, exists := aggregateFuncs[strings.ToUpper(call.Name)]
+	return exists
+}
+
+// newAggregator builds the aggregator for call. The aggregated column is the
+// argument's name if it is a column reference, otherwise the argument is
+// expected to have been evaluated into a column of the same name beforehand.
+func newAggregator(call *Call) (shred.Aggregator, error) {
+	fn := aggregateFuncs[strings.ToUpper(call.Name)]
+	if len(call.Args) != fn.args {
+		return nil, planError(call.Pos, "%s expects %d argument(s), found %d", call.Name, fn.args, len(call.Args))
+	}
+
+	var col string
+	switch arg := call.Args[0].(type) {
+	case *Star:
+		if strings.ToUpper(call.Name) != "COUNT" {
+			return nil, planError(arg.Pos, "%s does not accept *", call.Name)
+		}
+	case *Ident:
+		col = arg.String()
+	default:
+		if err := checkScalar(arg, "inside an aggregate function"); err != nil {
+			return nil, err
+		}
+		col = arg.String()
+	}
+
+	for _, arg := range call.Args[1:] {
+		if err := checkScalar(arg, "inside an aggregate function"); err != nil {
+			return nil, err
+		}
+	}
+
+	agg, err := fn.build(col, call)
+	if err != nil {
+		return nil, err
+	}
+
+	return shred.As(call.String(), agg), nil
+}
+
+// computedArg returns the argument of an aggregate call that must be
+// evaluated into its own column before grouping, if any.
+func computedArg(call *Call, sc *scope) Expr {
+	switch arg := call.Args[0].(type) {
+	case *Star:
+		return nil
+	case *Ident:
+		if arg.Table == "" && len(sc.tables) == 0 {
+			return nil
+		}
+	}
+
+	return call.Args[0]
+}
@@ -0,0 +1,148 @@
+package interpreter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type Pos struct {
+	Line int
+	Char int
+}
+
+func (p Pos) Position() Pos {
+	return p
+}
+
+type Expr interface {
+	Position() Pos
+	String() string
+}
+
+type SelectStmt struct {
+	Pos
+	Fields  []Field
+	From    Source
+	Joins   []JoinClause
+	Where   Expr
+	GroupBy []Expr
+	OrderBy []OrderField
+	Limit   *int
+	Offset  int
+}
+
+type Field struct {
+	Expr  Expr
+	Alias string
+}
+
+func (f Field) Name() string {
+	if f.Alias != "" {
+		return f.Alias
+	}
+
+	return f.Expr.String()
+}
+
+type OrderField struct {
+	Expr Expr
+	Desc bool
+}
+
+type Source struct {
+	Pos
+	Name  string
+	Alias string
+}
+
+func (s Source) Ref() string {
+	if s.Alias != "" {
+		return s.Alias
+	}
+
+	return s.Name
+}
+
+type JoinClause struct {
+	Pos
+	Type   TokenType
+	Source Source
+	On     Expr
+}
+
+type Ident struct {
+	Pos
+	Table string
+	Name  string
+}
+
+func (i *Ident) String() string {
+	if i.Table != "" {
+		return i.Table + "." + i.Name
+	}
+
+	return i.Name
+}
+
+type Star struct {
+	Pos
+}
+
+func (s *Star) String() string {
+	return "*"
+}
+
+type Literal struct {
+	Pos
+	Val interface{}
+}
+
+func (l *Literal) String() string {
+	switch v := l.Val.(type) {
+	case string:
+		return strconv.Quote(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+type Call struct {
+	Pos
+	Name string
+	Args []Expr
+}
+
+func (c *Call) String() string {
+	args := make([]string, len(c.Args))
+	for i, arg := range c.Args {
+		args[i] = arg.String()
+	}
+
+	return c.Name + "(" + strings.Join(args, ", ") + ")"
+}
+
+type UnaryExpr struct {
+	Pos
+	Op   TokenType
+	Expr Expr
+}
+
+func (u *UnaryExpr) String() string {
+	if u.Op == Not {
+		return "NOT " + u.Expr.String()
+	}
+
+	return u.Op.String() + u.Expr.String()
+}
+
+type BinaryExpr struct {
+	Pos
+	Op    TokenType
+	Left  Expr
+	Right Expr
+}
+
+func (b *BinaryExpr) String() string {
+	return "(" + b.Left.String() + " " + b.Op.String() + " " + b.Right.String() + ")"
+}
@@ -0,0 +1,249 @@
+package interpreter
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/JamesOwenHall/shred"
+)
+
+// scope resolves column references against the records of a query. The
+// records of a joined query carry the columns of each source qualified by
+// its name or alias.
+type scope struct {
+	source string
+	tables []string
+}
+
+func (s *scope) lookup(rec shred.Record, ident *Ident) interface{} {
+	if val, exists := rec[ident.String()]; exists {
+		return val
+	} else if ident.Table != "" {
+		if ident.Table == s.source {
+			return rec.Get(ident.Name)
+		}
+		return nil
+	}
+
+	for _, table := range s.tables {
+		if val, exists := rec[table+"."+ident.Name]; exists {
+			return val
+		}
+	}
+
+	return nil
+}
+
+// eval evaluates expr against rec. Evaluation never fails: a missing column
+// or an operation on incompatible values yields nil, which behaves like NULL.
+func (s *scope) eval(expr Expr, rec shred.Record) interface{} {
+	switch expr := expr.(type) {
+	case *Ident:
+		return s.lookup(rec, expr)
+	case *Literal:
+		return expr.Val
+	case *Call:
+		// Aggregates are computed ahead of the projection under their own name.
+		return rec.Get(expr.String())
+	case *UnaryExpr:
+		return evalUnary(expr.Op, s.eval(expr.Expr, rec))
+	case *BinaryExpr:
+		return evalBinary(expr.Op, s.eval(expr.Left, rec), s.eval(expr.Right, rec))
+	default:
+		return nil
+	}
+}
+
+func evalUnary(op TokenType, val interface{}) interface{} {
+	switch op {
+	case Not:
+		if b, ok := val.(bool); ok {
+			return !b
+		}
+	case Minus:
+		if i, ok := toInt(val); ok {
+			return -i
+		} else if f, ok := toFloat(val); ok {
+			return -f
+		}
+	}
+
+	return nil
+}
+
+func evalBinary(op TokenType, left, right interface{}) interface{} {
+	switch op {
+	case And:
+		l, lok := left.(bool)
+		r, rok := right.(bool)
+		if (lok && !l) || (rok && !r) {
+			return false
+		} else if lok && rok {
+			return true
+		}
+	case Or:
+		l, lok := left.(bool)
+		r, rok := right.(bool)
+		if (lok && l) || (rok && r) {
+			return true
+		} else if lok && rok {
+			return false
+		}
+	case Equal, NotEqual, Less, LessEqual, Greater, GreaterEqual:
+		return evalComparison(op, left, right)
+	case Plus, Minus, Asterisk, Slash, Percent:
+		return evalArithmetic(op, left, right)
+	}
+
+	return nil
+}
+
+func evalComparison(op TokenType, left, right interface{}) interface{} {
+	c, ok := compare(left, right)
+	if !ok {
+		return nil
+	}
+
+	switch op {
+	case Equal:
+		return c == 0
+	case NotEqual:
+		return c != 0
+	case Less:
+		return c < 0
+	case LessEqual:
+		return c <= 0
+	case Greater:
+		return c > 0
+	case GreaterEqual:
+		return c >= 0
+	}
+
+	return nil
+}
+
+func evalArithmetic(op TokenType, left, right interface{}) interface{} {
+	l, lok := toInt(left)
+	r, rok := toInt(right)
+	if lok && rok {
+		switch op {
+		case Plus:
+			return l + r
+		case Minus:
+			return l - r
+		case Asterisk:
+			return l * r
+		case Slash:
+			if r != 0 {
+				return l / r
+			}
+		case Percent:
+			if r != 0 {
+				return l % r
+			}
+		}
+		return nil
+	}
+
+	lf, lok := toFloat(left)
+	rf, rok := toFloat(right)
+	if !lok || !rok {
+		return nil
+	}
+
+	switch op {
+	case Plus:
+		return lf + rf
+	case Minus:
+		return lf - rf
+	case Asterisk:
+		return lf * rf
+	case Slash:
+		if rf != 0 {
+			return lf / rf
+		}
+	case Percent:
+		if rf != 0 {
+			return math.Mod(lf, rf)
+		}
+	}
+
+	return nil
+}
+
+// compare orders two values, treating numeric strings as numbers so that
+// sources which only produce strings can still be compared against literals.
+func compare(left, right interface{}) (int, bool) {
+	if l, ok := toInt(left); ok {
+		if r, ok := toInt(right); ok {
+			switch {
+			case l < r:
+				return -1, true
+			case l > r:
+				return 1, true
+			default:
+				return 0, true
+			}
+		}
+	}
+
+	if l, ok := toFloat(left); ok {
+		if r, ok := toFloat(right); ok {
+			switch {
+			case l < r:
+				return -1, true
+			case l > r:
+				return 1, true
+			default:
+				return 0, true
+			}
+		}
+	}
+
+	switch l := left.(type) {
+	case string:
+		if r, ok := right.(string); ok {
+			return strings.Compare(l, r), true
+		}
+	case bool:
+		if r, ok := right.(bool); ok {
+			switch {
+			case l == r:
+				return 0, true
+			case r:
+				return -1, true
+			default:
+				return 1, true
+			}
+		}
+	}
+
+	return 0, false
+}
+
+func toInt(val interface{}) (int, bool) {
+	switch val := val.(type) {
+	case int:
+		return val, true
+	case string:
+		i, err := strconv.Atoi(val)
+		return i, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func toFloat(val interface{}) (float64, bool) {
+	switch val := val.(type) {
+	case float64:
+		return val, true
+	case int:
+		return float64(val), true
+	case string:
+		f, err := strconv.ParseFloat(val, 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,489 @@
+package interpreter
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+)
+
+type ParseError struct {
+	Line int
+	Char int
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Char, e.Msg)
+}
+
+type Parser struct {
+	scanner *Scanner
+	tok     Token
+	peeked  bool
+}
+
+func NewParser(reader *bufio.Reader) *Parser {
+	return &Parser{
+		scanner: NewScanner(reader),
+	}
+}
+
+func Parse(query string) (*SelectStmt, error) {
+	return NewParser(bufio.NewReader(strings.NewReader(query))).Parse()
+}
+
+func (p *Parser) Parse() (*SelectStmt, error) {
+	start, err := p.expect(Select)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := &SelectStmt{Pos: tokenPos(start)}
+	if stmt.Fields, err = p.parseFields(); err != nil {
+		return nil, err
+	}
+
+	if _, err := p.expect(From); err != nil {
+		return nil, err
+	}
+	if stmt.From, err = p.parseSource(); err != nil {
+		return nil, err
+	}
+
+	for isJoin(p.peek().Type) {
+		join, err := p.parseJoin()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Joins = append(stmt.Joins, join)
+	}
+
+	if p.peek().Type == Where {
+		p.next()
+		if stmt.Where, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.peek().Type == Group {
+		p.next()
+		if _, err := p.expect(By); err != nil {
+			return nil, err
+		}
+		if stmt.GroupBy, err = p.parseExprList(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.peek().Type == Order {
+		p.next()
+		if _, err := p.expect(By); err != nil {
+			return nil, err
+		}
+		if stmt.OrderBy, err = p.parseOrderFields(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.peek().Type == Limit {
+		p.next()
+		limit, err := p.parseCount()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Limit = &limit
+	}
+
+	if p.peek().Type == Offset {
+		p.next()
+		if stmt.Offset, err = p.parseCount(); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := p.expect(EOF); err != nil {
+		return nil, err
+	}
+
+	return stmt, nil
+}
+
+func (p *Parser) parseCount() (int, error) {
+	tok, err := p.expect(Integer)
+	if err != nil {
+		return 0, err
+	}
+
+	return tok.Val.(int), nil
+}
+
+func (p *Parser) parseOrderFields() ([]OrderField, error) {
+	var fields []OrderField
+	for {
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+
+		field := OrderField{Expr: expr}
+		switch p.peek().Type {
+		case Asc:
+			p.next()
+		case Desc:
+			p.next()
+			field.Desc = true
+		}
+		fields = append(fields, field)
+
+		if p.peek().Type != Comma {
+			return fields, nil
+		}
+		p.next()
+	}
+}
+
+func (p *Parser) parseFields() ([]Field, error) {
+	var fields []Field
+	for {
+		// A lone * selects every column.
+		if p.peek().Type == Asterisk {
+			star := p.next()
+			fields = append(fields, Field{Expr: &Star{Pos: tokenPos(star)}})
+		} else {
+			field, err := p.parseField()
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, field)
+		}
+
+		if p.peek().Type != Comma {
+			return fields, nil
+		}
+		p.next()
+	}
+}
+
+func (p *Parser) parseField() (Field, error) {
+	expr, err := p.parseExpr()
+	if err != nil {
+		return Field{}, err
+	}
+
+	field := Field{Expr: expr}
+	if p.peek().Type == As {
+		p.next()
+		alias, err := p.expect(Identifier)
+		if err != nil {
+			return Field{}, err
+		}
+		field.Alias = alias.Val.(string)
+	}
+
+	return field, nil
+}
+
+func (p *Parser) parseSource() (Source, error) {
+	name, err := p.expect(Identifier)
+	if err != nil {
+		return Source{}, err
+	}
+
+	source := Source{Pos: tokenPos(name), Name: name.Val.(string)}
+	if p.peek().Type == As {
+		p.next()
+		alias, err := p.expect(Identifier)
+		if err != nil {
+			return Source{}, err
+		}
+		source.Alias = alias.Val.(string)
+	} else if p.peek().Type == Identifier {
+		source.Alias = p.next().Val.(string)
+	}
+
+	return source, nil
+}
+
+func (p *Parser) parseJoin() (JoinClause, error) {
+	start := p.next()
+	join := JoinClause{Pos: tokenPos(start), Type: Inner}
+	switch start.Type {
+	case Left, Right, Full:
+		join.Type = start.Type
+		if p.peek().Type == Outer {
+			p.next()
+		}
+		fallthrough
+	case Inner:
+		if _, err := p.expect(Join); err != nil {
+			return JoinClause{}, err
+		}
+	}
+
+	var err error
+	if join.Source, err = p.parseSource(); err != nil {
+		return JoinClause{}, err
+	}
+	if _, err := p.expect(On); err != nil {
+		return JoinClause{}, err
+	}
+	if join.On, err = p.parseExpr(); err != nil {
+		return JoinClause{}, err
+	}
+
+	return join, nil
+}
+
+func (p *Parser) parseExprList() ([]Expr, error) {
+	var exprs []Expr
+	for {
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+
+		if p.peek().Type != Comma {
+			return exprs, nil
+		}
+		p.next()
+	}
+}
+
+func (p *Parser) parseExpr() (Expr, error) {
+	return p.parseOr()
+}
+
+func (p *Parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().Type == Or {
+		op := p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Pos: tokenPos(op), Op: op.Type, Left: left, Right: right}
+	}
+
+	return left, nil
+}
+
+func (p *Parser) parseAnd() (Expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().Type == And {
+		op := p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Pos: tokenPos(op), Op: op.Type, Left: left, Right: right}
+	}
+
+	return left, nil
+}
+
+func (p *Parser) parseNot() (Expr, error) {
+	if p.peek().Type != Not {
+		return p.parseComparison()
+	}
+
+	op := p.next()
+	expr, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	return &UnaryExpr{Pos: tokenPos(op), Op: op.Type, Expr: expr}, nil
+}
+
+func (p *Parser) parseComparison() (Expr, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+
+	switch p.peek().Type {
+	case Equal, NotEqual, Less, LessEqual, Greater, GreaterEqual:
+		op := p.next()
+		right, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &BinaryExpr{Pos: tokenPos(op), Op: op.Type, Left: left, Right: right}, nil
+	}
+
+	return left, nil
+}
+
+func (p *Parser) parseAdditive() (Expr, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().Type == Plus || p.peek().Type == Minus {
+		op := p.next()
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Pos: tokenPos(op), Op: op.Type, Left: left, Right: right}
+	}
+
+	return left, nil
+}
+
+func (p *Parser) parseMultiplicative() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().Type == Asterisk || p.peek().Type == Slash || p.peek().Type == Percent {
+		op := p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Pos: tokenPos(op), Op: op.Type, Left: left, Right: right}
+	}
+
+	return left, nil
+}
+
+func (p *Parser) parseUnary() (Expr, error) {
+	if p.peek().Type != Minus {
+		return p.parsePrimary()
+	}
+
+	op := p.next()
+	expr, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	return &UnaryExpr{Pos: tokenPos(op), Op: op.Type, Expr: expr}, nil
+}
+
+func (p *Parser) parsePrimary() (Expr, error) {
+	tok := p.peek()
+	switch tok.Type {
+	case Identifier:
+		p.next()
+		switch p.peek().Type {
+		case OpenParen:
+			return p.parseCall(tok)
+		case Period:
+			p.next()
+			name, err := p.expect(Identifier)
+			if err != nil {
+				return nil, err
+			}
+			return &Ident{Pos: tokenPos(tok), Table: tok.Val.(string), Name: name.Val.(string)}, nil
+		}
+		return &Ident{Pos: tokenPos(tok), Name: tok.Val.(string)}, nil
+	case String, Integer, Float, Boolean:
+		p.next()
+		return &Literal{Pos: tokenPos(tok), Val: tok.Val}, nil
+	case OpenParen:
+		p.next()
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(CloseParen); err != nil {
+			return nil, err
+		}
+		return expr, nil
+	}
+
+	return nil, p.unexpected(tok, "expression")
+}
+
+func (p *Parser) parseCall(name Token) (Expr, error) {
+	p.next()
+	call := &Call{Pos: tokenPos(name), Name: name.Val.(string)}
+	switch p.peek().Type {
+	case CloseParen:
+		p.next()
+		return call, nil
+	case Asterisk:
+		star := p.next()
+		if _, err := p.expect(CloseParen); err != nil {
+			return nil, err
+		}
+		call.Args = []Expr{&Star{Pos: tokenPos(star)}}
+		return call, nil
+	}
+
+	args, err := p.parseExprList()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(CloseParen); err != nil {
+		return nil, err
+	}
+
+	call.Args = args
+	return call, nil
+}
+
+func (p *Parser) peek() Token {
+	if !p.peeked {
+		p.tok = p.scanner.Next()
+		p.peeked = true
+	}
+
+	return p.tok
+}
+
+func (p *Parser) next() Token {
+	tok := p.peek()
+	p.peeked = false
+	return tok
+}
+
+func (p *Parser) expect(Type TokenType) (Token, error) {
+	tok := p.peek()
+	if tok.Type != Type {
+		return tok, p.unexpected(tok, Type.String())
+	}
+
+	return p.next(), nil
+}
+
+func (p *Parser) unexpected(tok Token, expected string) error {
+	err := &ParseError{Line: tok.Line, Char: tok.Char}
+	switch tok.Type {
+	case ReadError:
+		err.Msg = fmt.Sprintf("read error: %v", tok.Val)
+	case UnknownToken:
+		err.Msg = fmt.Sprintf("unknown token %q", tok.Val)
+	case InvalidString:
+		err.Msg = fmt.Sprintf("invalid string %q", tok.Val)
+	case EOF:
+		err.Msg = fmt.Sprintf("unexpected end of input, expected %s", expected)
+	case Identifier, String, Integer, Float, Boolean:
+		err.Msg = fmt.Sprintf("unexpected %s %v, expected %s", tok.Type, tok.Val, expected)
+	default:
+		err.Msg = fmt.Sprintf("unexpected %s, expected %s", tok.Type, expected)
+	}
+
+	return err
+}
+
+func isJoin(Type TokenType) bool {
+	return Type == Join || Type == Inner || Type == Left || Type == Right || Type == Full
+}
+
+func tokenPos(tok Token) Pos {
+	return Pos{Line: tok.Line, Char: tok.Char}
+}
@@ -0,0 +1,192 @@
+package interpreter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParserSelect(t *testing.T) {
+	expected := &SelectStmt{
+		Pos: Pos{Line: 0, Char: 0},
+		Fields: []Field{
+			{Expr: &Ident{Pos: Pos{Line: 0, Char: 7}, Name: "user_id"}},
+			{Expr: &Ident{Pos: Pos{Line: 0, Char: 16}, Name: "total_price"}, Alias: "total"},
+		},
+		From: Source{Pos: Pos{Line: 0, Char: 42}, Name: "orders"},
+	}
+
+	actual, err := Parse("SELECT user_id, total_price AS total FROM orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("\nexpected: %v\n  actual: %v", expected, actual)
+	}
+}
+
+func TestParserSelectStar(t *testing.T) {
+	expected := &SelectStmt{
+		Pos: Pos{Line: 0, Char: 0},
+		Fields: []Field{
+			{Expr: &Star{Pos: Pos{Line: 0, Char: 7}}},
+			{Expr: &Ident{Pos: Pos{Line: 0, Char: 10}, Name: "total_price"}, Alias: "total"},
+		},
+		From: Source{Pos: Pos{Line: 0, Char: 36}, Name: "orders"},
+	}
+
+	actual, err := Parse("SELECT *, total_price AS total FROM orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("\nexpected: %v\n  actual: %v", expected, actual)
+	}
+}
+
+func TestParserWhere(t *testing.T) {
+	stmt, err := Parse(`SELECT a FROM t WHERE NOT a AND (b OR c) AND is_valid(d, "x", 1)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `((NOT a AND (b OR c)) AND is_valid(d, "x", 1))`
+	if actual := stmt.Where.String(); actual != expected {
+		t.Fatalf("\nexpected: %v\n  actual: %v", expected, actual)
+	}
+}
+
+func TestParserOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a + b * c", "(a + (b * c))"},
+		{"a - 1 - -2", "((a - 1) - -2)"},
+		{"(a + b) % 3 / c", "(((a + b) % 3) / c)"},
+		{"a + 1 >= b * 2 AND c <> d", "(((a + 1) >= (b * 2)) AND (c != d))"},
+		{"NOT a = 1 OR b < 2", "(NOT (a = 1) OR (b < 2))"},
+	}
+
+	for i, test := range tests {
+		stmt, err := Parse("SELECT x FROM t WHERE " + test.input)
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if actual := stmt.Where.String(); actual != test.expected {
+			t.Fatalf("#%d\nexpected: %v\n  actual: %v", i, test.expected, actual)
+		}
+	}
+}
+
+func TestParserGroupBy(t *testing.T) {
+	stmt, err := Parse("SELECT a, b FROM t WHERE true GROUP BY a, b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Expr{
+		&Ident{Pos: Pos{Line: 0, Char: 39}, Name: "a"},
+		&Ident{Pos: Pos{Line: 0, Char: 42}, Name: "b"},
+	}
+	if !reflect.DeepEqual(expected, stmt.GroupBy) {
+		t.Fatalf("\nexpected: %v\n  actual: %v", expected, stmt.GroupBy)
+	}
+	if actual, ok := stmt.Where.(*Literal); !ok || actual.Val != true {
+		t.Fatalf("unexpected: %v", stmt.Where)
+	}
+}
+
+func TestParserOrderBy(t *testing.T) {
+	stmt, err := Parse("SELECT a, b FROM t ORDER BY a DESC, b ASC, a + b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []OrderField{
+		{Expr: &Ident{Pos: Pos{Line: 0, Char: 28}, Name: "a"}, Desc: true},
+		{Expr: &Ident{Pos: Pos{Line: 0, Char: 36}, Name: "b"}},
+		{Expr: &BinaryExpr{
+			Pos:   Pos{Line: 0, Char: 45},
+			Op:    Plus,
+			Left:  &Ident{Pos: Pos{Line: 0, Char: 43}, Name: "a"},
+			Right: &Ident{Pos: Pos{Line: 0, Char: 47}, Name: "b"},
+		}},
+	}
+	if !reflect.DeepEqual(expected, stmt.OrderBy) {
+		t.Fatalf("\nexpected: %v\n  actual: %v", expected, stmt.OrderBy)
+	}
+}
+
+func TestParserLimit(t *testing.T) {
+	stmt, err := Parse("SELECT a FROM t ORDER BY a LIMIT 10 OFFSET 20")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stmt.Limit == nil || *stmt.Limit != 10 || stmt.Offset != 20 {
+		t.Fatalf("unexpected: %v, %v", stmt.Limit, stmt.Offset)
+	}
+}
+
+func TestParserJoin(t *testing.T) {
+	stmt, err := Parse("SELECT u.name FROM users u LEFT OUTER JOIN orders AS o ON u.id = o.user_id JOIN items ON items.order_id = o.id")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if actual := stmt.From; actual.Name != "users" || actual.Ref() != "u" {
+		t.Fatalf("unexpected: %v", actual)
+	}
+	if actual := stmt.Fields[0].Expr.(*Ident); actual.Table != "u" || actual.Name != "name" {
+		t.Fatalf("unexpected: %v", actual)
+	}
+
+	expected := []struct {
+		Type TokenType
+		Ref  string
+		On   string
+	}{
+		{Left, "o", "(u.id = o.user_id)"},
+		{Inner, "items", "(items.order_id = o.id)"},
+	}
+	if len(stmt.Joins) != len(expected) {
+		t.Fatalf("unexpected: %v", stmt.Joins)
+	}
+	for i, expected := range expected {
+		join := stmt.Joins[i]
+		if join.Type != expected.Type || join.Source.Ref() != expected.Ref || join.On.String() != expected.On {
+			t.Fatalf("#%d\nexpected: %v\n  actual: %v", i, expected, join)
+		}
+	}
+}
+
+func TestParserErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		err   ParseError
+	}{
+		{"FROM t", ParseError{Line: 0, Char: 0, Msg: "unexpected FROM, expected SELECT"}},
+		{"SELECT a", ParseError{Line: 0, Char: 8, Msg: "unexpected end of input, expected FROM"}},
+		{"SELECT a,\nFROM t", ParseError{Line: 1, Char: 0, Msg: "unexpected FROM, expected expression"}},
+		{"SELECT a FROM t WHERE (a", ParseError{Line: 0, Char: 24, Msg: "unexpected end of input, expected )"}},
+		{"SELECT a FROM t GROUP a", ParseError{Line: 0, Char: 22, Msg: "unexpected identifier a, expected BY"}},
+		{"SELECT a FROM t ORDER a", ParseError{Line: 0, Char: 22, Msg: "unexpected identifier a, expected BY"}},
+		{"SELECT a FROM t ORDER BY a DESC b", ParseError{Line: 0, Char: 32, Msg: "unexpected identifier b, expected EOF"}},
+		{"SELECT a FROM t LIMIT a", ParseError{Line: 0, Char: 22, Msg: "unexpected identifier a, expected integer"}},
+		{"SELECT a FROM t LIMIT 1.5", ParseError{Line: 0, Char: 22, Msg: "unexpected float 1.5, expected integer"}},
+		{"SELECT a FROM t t u", ParseError{Line: 0, Char: 18, Msg: "unexpected identifier u, expected EOF"}},
+		{"SELECT a FROM t LEFT OUTER u", ParseError{Line: 0, Char: 27, Msg: "unexpected identifier u, expected JOIN"}},
+		{"SELECT a FROM t JOIN u WHERE", ParseError{Line: 0, Char: 23, Msg: "unexpected WHERE, expected ON"}},
+		{"SELECT t. FROM t", ParseError{Line: 0, Char: 10, Msg: "unexpected FROM, expected identifier"}},
+		{"SELECT a FROM t WHERE #", ParseError{Line: 0, Char: 22, Msg: `unknown token "#"`}},
+		{"SELECT a FROM t WHERE x = \"abc", ParseError{Line: 0, Char: 26, Msg: `invalid string "abc"`}},
+		{"SELECT a FROM t\nWHERE x = \"abc\\", ParseError{Line: 1, Char: 10, Msg: `invalid string "abc"`}},
+	}
+
+	for i, test := range tests {
+		_, err := Parse(test.input)
+		if actual, ok := err.(*ParseError); !ok || *actual != test.err {
+			t.Fatalf("#%d\nexpected: %v\n  actual: %v", i, &test.err, err)
+		}
+	}
+}
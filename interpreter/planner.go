@@ -0,0 +1,451 @@
+package interpreter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/JamesOwenHall/shred"
+)
+
+type PlanError struct {
+	Line int
+	Char int
+	Msg  string
+}
+
+func (e *PlanError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Char, e.Msg)
+}
+
+type Planner struct {
+	sources map[string]shred.Iterator
+}
+
+func NewPlanner() *Planner {
+	return &Planner{
+		sources: make(map[string]shred.Iterator),
+	}
+}
+
+func (p *Planner) Register(name string, source shred.Iterator) {
+	p.sources[name] = source
+}
+
+func (p *Planner) Query(query string) (*shred.Dataset, error) {
+	stmt, err := Parse(query)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.Plan(stmt)
+}
+
+var joinTypes = map[TokenType]shred.JoinType{
+	Inner: shred.JoinInner,
+	Left:  shred.JoinLeft,
+	Right: shred.JoinRight,
+	Full:  shred.JoinFull,
+}
+
+func (p *Planner) Plan(stmt *SelectStmt) (*shred.Dataset, error) {
+	dataset, sc, err := p.planSources(stmt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkTables(stmt, sc); err != nil {
+		return nil, err
+	}
+
+	if stmt.Where != nil {
+		if err := checkScalar(stmt.Where, "in WHERE"); err != nil {
+			return nil, err
+		}
+
+		where := stmt.Where
+		dataset = dataset.Filter(func(r shred.Record) bool {
+			return sc.eval(where, r) == true
+		})
+	}
+
+	var star *Star
+	exprs := make([]Expr, 0, len(stmt.Fields)+len(stmt.OrderBy))
+	for _, field := range stmt.Fields {
+		if s, ok := field.Expr.(*Star); ok {
+			star = s
+			continue
+		}
+		exprs = append(exprs, field.Expr)
+	}
+	orders := orderExprs(stmt)
+	exprs = append(exprs, orders...)
+
+	calls := aggregateCalls(exprs)
+	if len(stmt.GroupBy) > 0 || len(calls) > 0 {
+		if star != nil {
+			return nil, planError(star.Pos, "* is not allowed with GROUP BY or aggregate functions")
+		}
+		if dataset, err = planAggregate(dataset, stmt, sc, calls, exprs); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, expr := range exprs {
+			if err := checkScalar(expr, "without GROUP BY"); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(orders) > 0 {
+		dataset = planOrder(dataset, stmt, sc, orders)
+	}
+	dataset = planLimit(dataset, stmt)
+
+	fields := stmt.Fields
+	return dataset.Map(func(r shred.Record) shred.Record {
+		out := make(shred.Record, len(fields))
+		for _, field := range fields {
+			if _, ok := field.Expr.(*Star); !ok {
+				out[field.Name()] = sc.eval(field.Expr, r)
+				continue
+			}
+
+			for k, v := range r {
+				if !isHidden(k) {
+					out[k] = v
+				}
+			}
+		}
+		return out
+	}), nil
+}
+
+// planSources resolves the FROM clause and its joins. The columns of joined
+// sources are qualified with their reference so that they cannot collide.
+func (p *Planner) planSources(stmt *SelectStmt) (*shred.Dataset, *scope, error) {
+	source, exists := p.sources[stmt.From.Name]
+	if !exists {
+		return nil, nil, planError(stmt.From.Pos, "unknown source %q", stmt.From.Name)
+	}
+
+	dataset := shred.NewDataset(source.Clone())
+	if len(stmt.Joins) == 0 {
+		return dataset, &scope{source: stmt.From.Ref()}, nil
+	}
+
+	prefix := stmt.From.Ref() + "."
+	dataset = dataset.Map(func(r shred.Record) shred.Record {
+		out := make(shred.Record, len(r))
+		for k, v := range r {
+			out[prefix+k] = v
+		}
+		return out
+	})
+
+	tables := []string{stmt.From.Ref()}
+	for _, join := range stmt.Joins {
+		right, exists := p.sources[join.Source.Name]
+		if !exists {
+			return nil, nil, planError(join.Source.Pos, "unknown source %q", join.Source.Name)
+		}
+
+		ref := join.Source.Ref()
+		for _, table := range tables {
+			if table == ref {
+				return nil, nil, planError(join.Source.Pos, "duplicate table %q, use an alias", ref)
+			}
+		}
+
+		lKeys, rKeys, err := joinKeys(join, tables)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		tables = append(tables, ref)
+		dataset = dataset.Join(joinTypes[join.Type], lKeys, rKeys, right.Clone(), shred.JoinPrefixes("", ref+"."))
+	}
+
+	return dataset, &scope{tables: tables}, nil
+}
+
+// joinKeys extracts the key columns of a join from its ON clause, which must
+// be a conjunction of equalities between a column of the joined source and a
+// column of a source to its left.
+func joinKeys(join JoinClause, tables []string) ([]string, []string, error) {
+	ref := join.Source.Ref()
+	isLeft := func(table string) bool {
+		for _, t := range tables {
+			if t == table {
+				return true
+			}
+		}
+		return false
+	}
+
+	var lKeys, rKeys []string
+	for _, cond := range conjuncts(join.On) {
+		eq, ok := cond.(*BinaryExpr)
+		if !ok || eq.Op != Equal {
+			return nil, nil, planError(cond.Position(), "ON expects equalities between qualified columns, found %s", cond)
+		}
+
+		l, lok := eq.Left.(*Ident)
+		r, rok := eq.Right.(*Ident)
+		if lok && rok && l.Table == ref && isLeft(r.Table) {
+			l, r = r, l
+		}
+		if !lok || !rok || !isLeft(l.Table) || r.Table != ref {
+			return nil, nil, planError(eq.Pos, "ON expects equalities between qualified columns, found %s", eq)
+		}
+
+		lKeys = append(lKeys, l.String())
+		rKeys = append(rKeys, r.Name)
+	}
+
+	return lKeys, rKeys, nil
+}
+
+func conjuncts(expr Expr) []Expr {
+	if and, ok := expr.(*BinaryExpr); ok && and.Op == And {
+		return append(conjuncts(and.Left), conjuncts(and.Right)...)
+	}
+
+	return []Expr{expr}
+}
+
+// checkTables ensures that every qualified column refers to a known source.
+func checkTables(stmt *SelectStmt, sc *scope) error {
+	exprs := []Expr{}
+	for _, field := range stmt.Fields {
+		exprs = append(exprs, field.Expr)
+	}
+	if stmt.Where != nil {
+		exprs = append(exprs, stmt.Where)
+	}
+	exprs = append(exprs, stmt.GroupBy...)
+	for _, order := range stmt.OrderBy {
+		exprs = append(exprs, order.Expr)
+	}
+
+	for _, expr := range exprs {
+		if err := walk(expr, func(expr Expr) error {
+			ident, ok := expr.(*Ident)
+			if !ok || ident.Table == "" || ident.Table == sc.source {
+				return nil
+			}
+			for _, table := range sc.tables {
+				if table == ident.Table {
+					return nil
+				}
+			}
+			return planError(ident.Pos, "unknown table %q", ident.Table)
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func planAggregate(dataset *shred.Dataset, stmt *SelectStmt, sc *scope, calls []*Call, exprs []Expr) (*shred.Dataset, error) {
+	keys := make([]string, len(stmt.GroupBy))
+	var computed []Expr
+	for i, expr := range stmt.GroupBy {
+		ident, ok := expr.(*Ident)
+		if !ok {
+			return nil, planError(expr.Position(), "GROUP BY expects a column name, found %s", expr)
+		}
+
+		keys[i] = ident.String()
+		if ident.Table != "" || len(sc.tables) > 0 {
+			computed = append(computed, ident)
+		}
+	}
+
+	for _, expr := range exprs {
+		if err := checkGrouped(expr, keys); err != nil {
+			return nil, err
+		}
+	}
+
+	aggs := make([]shred.Aggregator, len(calls))
+	for i, call := range calls {
+		agg, err := newAggregator(call)
+		if err != nil {
+			return nil, err
+		}
+
+		aggs[i] = agg
+		if arg := computedArg(call, sc); arg != nil {
+			computed = append(computed, arg)
+		}
+	}
+
+	if len(computed) > 0 {
+		dataset = dataset.Map(func(r shred.Record) shred.Record {
+			out := r.Clone()
+			for _, expr := range computed {
+				out[expr.String()] = sc.eval(expr, r)
+			}
+			return out
+		})
+	}
+
+	return dataset.GroupBy(keys...).Aggregate(aggs...), nil
+}
+
+// orderExprs resolves the ORDER BY expressions, which may refer to fields by
+// their alias.
+func orderExprs(stmt *SelectStmt) []Expr {
+	exprs := make([]Expr, len(stmt.OrderBy))
+	for i, order := range stmt.OrderBy {
+		exprs[i] = order.Expr
+		if ident, ok := order.Expr.(*Ident); ok && ident.Table == "" {
+			for _, field := range stmt.Fields {
+				if field.Alias == ident.Name {
+					exprs[i] = field.Expr
+					break
+				}
+			}
+		}
+	}
+
+	return exprs
+}
+
+// planOrder evaluates the ORDER BY expressions into hidden columns, which the
+// projection drops, and sorts on them. With a LIMIT, only the records that
+// can make it past the OFFSET and LIMIT are kept.
+func planOrder(dataset *shred.Dataset, stmt *SelectStmt, sc *scope, exprs []Expr) *shred.Dataset {
+	orders := make([]shred.Order, len(exprs))
+	for i, order := range stmt.OrderBy {
+		if order.Desc {
+			orders[i] = shred.Desc(orderColumn(i))
+		} else {
+			orders[i] = shred.Asc(orderColumn(i))
+		}
+	}
+
+	dataset = dataset.Map(func(r shred.Record) shred.Record {
+		out := r.Clone()
+		for i, expr := range exprs {
+			out[orderColumn(i)] = sc.eval(expr, r)
+		}
+		return out
+	})
+
+	if stmt.Limit != nil {
+		return dataset.TopN(stmt.Offset+*stmt.Limit, orders...)
+	}
+	return dataset.OrderBy(orders...)
+}
+
+// planLimit skips the first OFFSET records and stops after LIMIT records.
+func planLimit(dataset *shred.Dataset, stmt *SelectStmt) *shred.Dataset {
+	if stmt.Offset > 0 {
+		dataset = dataset.Skip(stmt.Offset)
+	}
+	if stmt.Limit != nil {
+		dataset = dataset.Limit(*stmt.Limit)
+	}
+
+	return dataset
+}
+
+// orderColumn names the hidden column of an ORDER BY expression. It cannot
+// clash with a column of the query since '#' is not a valid identifier.
+func orderColumn(i int) string {
+	return fmt.Sprintf("#order%d", i)
+}
+
+func isHidden(col string) bool {
+	return strings.HasPrefix(col, "#")
+}
+
+// aggregateCalls returns the distinct aggregate calls among exprs.
+func aggregateCalls(exprs []Expr) []*Call {
+	var calls []*Call
+	seen := map[string]bool{}
+	for _, expr := range exprs {
+		walk(expr, func(expr Expr) error {
+			if call, ok := expr.(*Call); ok && isAggregate(call) && !seen[call.String()] {
+				seen[call.String()] = true
+				calls = append(calls, call)
+			}
+			return nil
+		})
+	}
+
+	return calls
+}
+
+// checkGrouped ensures that expr only references columns of the group key
+// outside of aggregate functions.
+func checkGrouped(expr Expr, keys []string) error {
+	switch expr := expr.(type) {
+	case *Ident:
+		for _, key := range keys {
+			if key == expr.String() {
+				return nil
+			}
+		}
+		return planError(expr.Pos, "column %q must appear in GROUP BY", expr.String())
+	case *Call:
+		if !isAggregate(expr) {
+			return planError(expr.Pos, "unknown function %q", expr.Name)
+		}
+	case *UnaryExpr:
+		return checkGrouped(expr.Expr, keys)
+	case *BinaryExpr:
+		if err := checkGrouped(expr.Left, keys); err != nil {
+			return err
+		}
+		return checkGrouped(expr.Right, keys)
+	}
+
+	return nil
+}
+
+// checkScalar ensures that expr can be evaluated against a single record.
+func checkScalar(expr Expr, context string) error {
+	return walk(expr, func(expr Expr) error {
+		switch expr := expr.(type) {
+		case *Call:
+			if isAggregate(expr) {
+				return planError(expr.Pos, "aggregate function %s is not allowed %s", expr.Name, context)
+			}
+			return planError(expr.Pos, "unknown function %q", expr.Name)
+		case *Star:
+			return planError(expr.Pos, "unexpected *")
+		}
+		return nil
+	})
+}
+
+func walk(expr Expr, fn func(Expr) error) error {
+	if err := fn(expr); err != nil {
+		return err
+	}
+
+	switch expr := expr.(type) {
+	case *Call:
+		for _, arg := range expr.Args {
+			if err := walk(arg, fn); err != nil {
+				return err
+			}
+		}
+	case *UnaryExpr:
+		return walk(expr.Expr, fn)
+	case *BinaryExpr:
+		if err := walk(expr.Left, fn); err != nil {
+			return err
+		}
+		return walk(expr.Right, fn)
+	}
+
+	return nil
+}
+
+func planError(pos Pos, format string, args ...interface{}) error {
+	return &PlanError{Line: pos.Line, Char: pos.Char, Msg: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,476 @@
+package interpreter
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/JamesOwenHall/shred"
+)
+
+type recordIterator []shred.Record
+
+func (r *recordIterator) Clone() shred.Iterator {
+	clone := make(recordIterator, 0, len(*r))
+	for _, rec := range *r {
+		clone = append(clone, rec.Clone())
+	}
+	return &clone
+}
+
+func (r *recordIterator) Next() (shred.Record, error) {
+	if len(*r) == 0 {
+		return nil, nil
+	}
+
+	rec := (*r)[0]
+	*r = (*r)[1:]
+	return rec, nil
+}
+
+func ordersPlanner() *Planner {
+	planner := NewPlanner()
+	planner.Register("orders", &recordIterator{
+		{"user_id": 1, "order_id": 1, "total_price": 25, "paid": true},
+		{"user_id": 1, "order_id": 2, "total_price": 55, "paid": false},
+		{"user_id": 2, "order_id": 3, "total_price": 11, "paid": true},
+	})
+	return planner
+}
+
+// pricesPlanner registers a table of strings, like the ones read from CSV and
+// SQL sources.
+func pricesPlanner() *Planner {
+	planner := NewPlanner()
+	planner.Register("prices", &recordIterator{
+		{"id": "1", "price": "9"},
+		{"id": "2", "price": "100"},
+		{"id": "3", "price": "10"},
+	})
+	return planner
+}
+
+func TestPlannerProjection(t *testing.T) {
+	expected := []shred.Record{
+		{"user_id": 1, "total": 25},
+		{"user_id": 1, "total": 55},
+		{"user_id": 2, "total": 11},
+	}
+
+	dataset, err := ordersPlanner().Query("SELECT user_id, total_price AS total FROM orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := dataset.Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected: %v\nactual: %v", expected, actual)
+	}
+}
+
+func TestPlannerSelectStar(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected []shred.Record
+	}{
+		{"SELECT * FROM orders WHERE user_id = 2", []shred.Record{
+			{"user_id": 2, "order_id": 3, "total_price": 11, "paid": true},
+		}},
+		{"SELECT *, total_price * 2 AS double FROM orders ORDER BY total_price DESC LIMIT 1", []shred.Record{
+			{"user_id": 1, "order_id": 2, "total_price": 55, "paid": false, "double": 110},
+		}},
+	}
+
+	planner := ordersPlanner()
+	for i, test := range tests {
+		dataset, err := planner.Query(test.query)
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+
+		actual, err := dataset.Collect()
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if !reflect.DeepEqual(test.expected, actual) {
+			t.Fatalf("#%d\nexpected: %v\nactual: %v", i, test.expected, actual)
+		}
+	}
+}
+
+func TestPlannerWhere(t *testing.T) {
+	expected := []shred.Record{
+		{"order_id": 1},
+		{"order_id": 3},
+	}
+
+	planner := ordersPlanner()
+	for i := 0; i < 2; i++ {
+		dataset, err := planner.Query("SELECT order_id FROM orders WHERE paid AND NOT false")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		actual, err := dataset.Collect()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(expected, actual) {
+			t.Fatalf("#%d\nexpected: %v\nactual: %v", i, expected, actual)
+		}
+	}
+}
+
+func TestPlannerComparison(t *testing.T) {
+	planner := NewPlanner()
+	planner.Register("orders", &recordIterator{
+		{"user_id": "1", "total_price": "25"},
+		{"user_id": "1", "total_price": "55"},
+		{"user_id": "2", "total_price": "11"},
+	})
+	expected := []shred.Record{
+		{"user_id": "1", "total_price": "25", "(total_price * 2)": 50},
+		{"user_id": "1", "total_price": "55", "(total_price * 2)": 110},
+	}
+
+	dataset, err := planner.Query("SELECT user_id, total_price, total_price * 2 FROM orders WHERE total_price > 20")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := dataset.Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected: %v\nactual: %v", expected, actual)
+	}
+}
+
+func TestPlannerEval(t *testing.T) {
+	rec := shred.Record{"a": 7, "b": "2", "f": 2.5, "g": "0.5", "s": "foo", "n": nil}
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"a + b * 3", 13},
+		{"-a % b", -1},
+		{"a / 0", nil},
+		{"a * f", 17.5},
+		{"f + g - 1e1", -7.0},
+		{"-f % 2", -0.5},
+		{"f / 0.0", nil},
+		{"a > f AND g < 1", true},
+		{"a - n", nil},
+		{"s = \"foo\" AND a <> b", true},
+		{"s < \"bar\"", false},
+		{"s > 1", nil},
+		{"n = 1 OR a >= 7", true},
+		{"n = 1 AND a >= 7", nil},
+	}
+
+	for i, test := range tests {
+		stmt, err := Parse("SELECT " + test.input + " FROM t")
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if actual := new(scope).eval(stmt.Fields[0].Expr, rec); actual != test.expected {
+			t.Fatalf("#%d\nexpected: %v\n  actual: %v", i, test.expected, actual)
+		}
+	}
+}
+
+func TestPlannerGroupBy(t *testing.T) {
+	expected := []shred.Record{
+		{"user_id": 1},
+		{"user_id": 2},
+	}
+
+	dataset, err := ordersPlanner().Query("SELECT user_id FROM orders GROUP BY user_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := dataset.SortInt("user_id").Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected: %v\nactual: %v", expected, actual)
+	}
+}
+
+func TestPlannerAggregate(t *testing.T) {
+	expected := []shred.Record{
+		{"user_id": 2, "paid": true, "orders": 1, "SUM((total_price * 2))": 22, "avg": 11.0},
+		{"user_id": 1, "paid": true, "orders": 1, "SUM((total_price * 2))": 50, "avg": 25.0},
+		{"user_id": 1, "paid": false, "orders": 1, "SUM((total_price * 2))": 110, "avg": 55.0},
+	}
+
+	dataset, err := ordersPlanner().Query(`
+		SELECT user_id, paid, COUNT(*) AS orders, SUM(total_price * 2), SUM(total_price) / count(order_id) AS avg
+		FROM orders
+		GROUP BY user_id, paid`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := dataset.Map(func(r shred.Record) shred.Record {
+		return r.Set("avg", r.Float("avg"))
+	}).SortInt("SUM((total_price * 2))").Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected: %v\nactual: %v", expected, actual)
+	}
+}
+
+func TestPlannerOrderBy(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected []shred.Record
+	}{
+		{"SELECT order_id FROM orders ORDER BY user_id DESC, total_price", []shred.Record{
+			{"order_id": 3},
+			{"order_id": 1},
+			{"order_id": 2},
+		}},
+		{"SELECT order_id, total_price * -1 AS neg FROM orders ORDER BY neg ASC", []shred.Record{
+			{"order_id": 2, "neg": -55},
+			{"order_id": 1, "neg": -25},
+			{"order_id": 3, "neg": -11},
+		}},
+		{"SELECT user_id, SUM(total_price) AS total FROM orders GROUP BY user_id ORDER BY COUNT(*) DESC", []shred.Record{
+			{"user_id": 1, "total": 80},
+			{"user_id": 2, "total": 11},
+		}},
+		{"SELECT order_id FROM orders ORDER BY total_price DESC LIMIT 2", []shred.Record{
+			{"order_id": 2},
+			{"order_id": 1},
+		}},
+		{"SELECT order_id FROM orders ORDER BY total_price DESC LIMIT 1 OFFSET 1", []shred.Record{
+			{"order_id": 1},
+		}},
+		{"SELECT order_id FROM orders LIMIT 2", []shred.Record{
+			{"order_id": 1},
+			{"order_id": 2},
+		}},
+		{"SELECT order_id FROM orders OFFSET 1", []shred.Record{
+			{"order_id": 2},
+			{"order_id": 3},
+		}},
+		{"SELECT order_id FROM orders LIMIT 5 OFFSET 3", []shred.Record{}},
+	}
+
+	planner := ordersPlanner()
+	for i, test := range tests {
+		dataset, err := planner.Query(test.query)
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+
+		actual, err := dataset.Collect()
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if !reflect.DeepEqual(test.expected, actual) {
+			t.Fatalf("#%d\nexpected: %v\nactual: %v", i, test.expected, actual)
+		}
+	}
+}
+
+func TestPlannerOrderByNumericStrings(t *testing.T) {
+	expected := []shred.Record{
+		{"id": "2", "price": "100"},
+		{"id": "3", "price": "10"},
+		{"id": "1", "price": "9"},
+	}
+
+	for limit := 0; limit <= len(expected); limit++ {
+		query := "SELECT id, price FROM prices ORDER BY price DESC"
+		if limit > 0 {
+			// A LIMIT plans a TopN instead of a full sort.
+			query += " LIMIT " + strconv.Itoa(limit)
+		}
+
+		dataset, err := pricesPlanner().Query(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		actual, err := dataset.Collect()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := expected
+		if limit > 0 {
+			want = expected[:limit]
+		}
+		if !reflect.DeepEqual(want, actual) {
+			t.Fatalf("%s\nexpected: %v\nactual: %v", query, want, actual)
+		}
+	}
+}
+
+func TestPlannerAggregateWithoutGroupBy(t *testing.T) {
+	tests := []struct {
+		planner  *Planner
+		query    string
+		expected []shred.Record
+	}{
+		{
+			ordersPlanner(),
+			`SELECT COUNT(*), MAX(total_price), MIN(total_price), PERCENTILE(total_price, 0.5)
+			FROM orders
+			WHERE user_id = 1`,
+			[]shred.Record{
+				{"COUNT(*)": 2, "MAX(total_price)": 55, "MIN(total_price)": 25, "PERCENTILE(total_price, 0.5)": 40.0},
+			},
+		},
+		{
+			ordersPlanner(),
+			"SELECT COUNT(*), SUM(total_price), AVG(total_price), MAX(total_price) FROM orders WHERE user_id = 999",
+			[]shred.Record{
+				{"COUNT(*)": 0, "SUM(total_price)": nil, "AVG(total_price)": nil, "MAX(total_price)": nil},
+			},
+		},
+		{
+			pricesPlanner(),
+			"SELECT MIN(price), MAX(price) FROM prices",
+			[]shred.Record{
+				{"MIN(price)": "9", "MAX(price)": "100"},
+			},
+		},
+	}
+
+	for i, test := range tests {
+		dataset, err := test.planner.Query(test.query)
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+
+		actual, err := dataset.Collect()
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if !reflect.DeepEqual(test.expected, actual) {
+			t.Fatalf("#%d\nexpected: %v\nactual: %v", i, test.expected, actual)
+		}
+	}
+}
+
+func usersPlanner() *Planner {
+	planner := ordersPlanner()
+	planner.Register("users", &recordIterator{
+		{"id": 1, "name": "John", "total_price": 0},
+		{"id": 2, "name": "Jane", "total_price": 0},
+		{"id": 3, "name": "Jack", "total_price": 0},
+	})
+	return planner
+}
+
+func TestPlannerQualifiedColumns(t *testing.T) {
+	expected := []shred.Record{
+		{"orders.total_price": 25},
+		{"orders.total_price": 11},
+	}
+
+	dataset, err := ordersPlanner().Query("SELECT orders.total_price FROM orders WHERE orders.paid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := dataset.Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected: %v\nactual: %v", expected, actual)
+	}
+}
+
+func TestPlannerJoin(t *testing.T) {
+	expected := []shred.Record{
+		{"name": "John", "u.total_price": 0, "o.total_price": 25},
+		{"name": "John", "u.total_price": 0, "o.total_price": 55},
+		{"name": "Jane", "u.total_price": 0, "o.total_price": 11},
+		{"name": "Jack", "u.total_price": 0, "o.total_price": nil},
+	}
+
+	dataset, err := usersPlanner().Query(`
+		SELECT name, u.total_price, o.total_price
+		FROM users u LEFT JOIN orders o ON o.user_id = u.id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := dataset.Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected: %v\nactual: %v", expected, actual)
+	}
+}
+
+func TestPlannerJoinGroupBy(t *testing.T) {
+	expected := []shred.Record{
+		{"name": "Jane", "spent": 11},
+		{"name": "John", "spent": 80},
+	}
+
+	dataset, err := usersPlanner().Query(`
+		SELECT name, SUM(orders.total_price) AS spent
+		FROM users JOIN orders ON users.id = orders.user_id
+		GROUP BY name`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := dataset.SortInt("spent").Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected: %v\nactual: %v", expected, actual)
+	}
+}
+
+func TestPlannerErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		err   PlanError
+	}{
+		{"SELECT a FROM customers", PlanError{Line: 0, Char: 14, Msg: `unknown source "customers"`}},
+		{"SELECT a FROM orders JOIN customers ON orders.a = customers.b", PlanError{Line: 0, Char: 26, Msg: `unknown source "customers"`}},
+		{"SELECT f(a) FROM orders", PlanError{Line: 0, Char: 7, Msg: `unknown function "f"`}},
+		{"SELECT order_id FROM orders GROUP BY user_id", PlanError{Line: 0, Char: 7, Msg: `column "order_id" must appear in GROUP BY`}},
+		{"SELECT user_id FROM orders GROUP BY user_id + 1", PlanError{Line: 0, Char: 44, Msg: "GROUP BY expects a column name, found (user_id + 1)"}},
+		{"SELECT order_id FROM orders WHERE COUNT(*) > 1", PlanError{Line: 0, Char: 34, Msg: "aggregate function COUNT is not allowed in WHERE"}},
+		{"SELECT SUM(COUNT(*)) FROM orders", PlanError{Line: 0, Char: 11, Msg: "aggregate function COUNT is not allowed inside an aggregate function"}},
+		{"SELECT SUM(*) FROM orders", PlanError{Line: 0, Char: 11, Msg: "SUM does not accept *"}},
+		{"SELECT SUM(a, b) FROM orders", PlanError{Line: 0, Char: 7, Msg: "SUM expects 1 argument(s), found 2"}},
+		{"SELECT users.id FROM orders", PlanError{Line: 0, Char: 7, Msg: `unknown table "users"`}},
+		{"SELECT id FROM users JOIN users ON users.id = users.id", PlanError{Line: 0, Char: 26, Msg: `duplicate table "users", use an alias`}},
+		{"SELECT id FROM users JOIN orders ON id = user_id", PlanError{Line: 0, Char: 39, Msg: "ON expects equalities between qualified columns, found (id = user_id)"}},
+		{"SELECT id FROM users JOIN orders ON users.id > orders.user_id", PlanError{Line: 0, Char: 45, Msg: "ON expects equalities between qualified columns, found (users.id > orders.user_id)"}},
+		{"SELECT id FROM users u JOIN orders o ON o.id = o.user_id", PlanError{Line: 0, Char: 45, Msg: "ON expects equalities between qualified columns, found (o.id = o.user_id)"}},
+		{"SELECT user_id FROM orders GROUP BY user_id ORDER BY order_id", PlanError{Line: 0, Char: 53, Msg: `column "order_id" must appear in GROUP BY`}},
+		{"SELECT id FROM orders ORDER BY users.id", PlanError{Line: 0, Char: 31, Msg: `unknown table "users"`}},
+		{"SELECT *, COUNT(*) FROM orders", PlanError{Line: 0, Char: 7, Msg: "* is not allowed with GROUP BY or aggregate functions"}},
+		{"SELECT PERCENTILE(a, 2) FROM orders", PlanError{Line: 0, Char: 21, Msg: "PERCENTILE expects a percentile between 0 and 1"}},
+	}
+
+	planner := usersPlanner()
+	for i, test := range tests {
+		_, err := planner.Query(test.input)
+		if actual, ok := err.(*PlanError); !ok || *actual != test.err {
+			t.Fatalf("#%d\nexpected: %v\n  actual: %v", i, &test.err, err)
+		}
+	}
+}
@@ -24,11 +24,28 @@ const (
 	Where
 	Group
 	By
+	As
+	And
+	Or
+	Not
+	Join
+	On
+	Inner
+	Left
+	Right
+	Full
+	Outer
+	Order
+	Asc
+	Desc
+	Limit
+	Offset
 
 	// Types
 	Identifier
 	String
 	Integer
+	Float
 	Boolean
 
 	// Punctuation
@@ -36,8 +53,77 @@ const (
 	Comma
 	OpenParen
 	CloseParen
+
+	// Operators
+	Equal
+	NotEqual
+	Less
+	LessEqual
+	Greater
+	GreaterEqual
+	Plus
+	Minus
+	Asterisk
+	Slash
+	Percent
 )
 
+var tokenNames = map[TokenType]string{
+	EOF:           "EOF",
+	ReadError:     "read error",
+	UnknownToken:  "unknown token",
+	InvalidString: "invalid string",
+	Select:        "SELECT",
+	From:          "FROM",
+	Where:         "WHERE",
+	Group:         "GROUP",
+	By:            "BY",
+	As:            "AS",
+	And:           "AND",
+	Or:            "OR",
+	Not:           "NOT",
+	Join:          "JOIN",
+	On:            "ON",
+	Inner:         "INNER",
+	Left:          "LEFT",
+	Right:         "RIGHT",
+	Full:          "FULL",
+	Outer:         "OUTER",
+	Order:         "ORDER",
+	Asc:           "ASC",
+	Desc:          "DESC",
+	Limit:         "LIMIT",
+	Offset:        "OFFSET",
+	Identifier:    "identifier",
+	String:        "string",
+	Integer:       "integer",
+	Float:         "float",
+	Boolean:       "boolean",
+	Period:        ".",
+	Comma:         ",",
+	OpenParen:     "(",
+	CloseParen:    ")",
+	Equal:         "=",
+	NotEqual:      "!=",
+	Less:          "<",
+	LessEqual:     "<=",
+	Greater:       ">",
+	GreaterEqual:  ">=",
+	Plus:          "+",
+	Minus:         "-",
+	Asterisk:      "*",
+	Slash:         "/",
+	Percent:       "%",
+}
+
+func (t TokenType) String() string {
+	if name, exists := tokenNames[t]; exists {
+		return name
+	}
+
+	return "TokenType(" + strconv.Itoa(int(t)) + ")"
+}
+
 type Token struct {
 	Type TokenType
 	Val  interface{}
@@ -82,6 +168,28 @@ func (s *Scanner) Next() Token {
 		return s.readSingle(OpenParen)
 	case ')':
 		return s.readSingle(CloseParen)
+	case '=':
+		return s.readSingle(Equal)
+	case '+':
+		return s.readSingle(Plus)
+	case '-':
+		return s.readSingle(Minus)
+	case '*':
+		return s.readSingle(Asterisk)
+	case '/':
+		return s.readSingle(Slash)
+	case '%':
+		return s.readSingle(Percent)
+	}
+
+	// Operators that may span two characters
+	switch current {
+	case '<':
+		return s.readOperator(Less, map[rune]TokenType{'=': LessEqual, '>': NotEqual})
+	case '>':
+		return s.readOperator(Greater, map[rune]TokenType{'=': GreaterEqual})
+	case '!':
+		return s.readOperator(UnknownToken, map[rune]TokenType{'=': NotEqual})
 	}
 
 	// Errors
@@ -102,8 +210,8 @@ func (s *Scanner) Next() Token {
 
 	if isAlpha(current) {
 		return s.readWord()
-	} else if isNumeric(current) || current == '-' {
-		return s.readInteger()
+	} else if isNumeric(current) {
+		return s.readNumber()
 	} else if current == '"' {
 		return s.readString()
 	}
@@ -131,7 +239,7 @@ func (s *Scanner) read() rune {
 
 	if s.current == '\n' {
 		s.line++
-		s.char = 0
+		s.char = -1
 	} else {
 		s.char++
 	}
@@ -150,6 +258,23 @@ func (s *Scanner) readSingle(Type TokenType) Token {
 	}
 }
 
+func (s *Scanner) readOperator(Type TokenType, pairs map[rune]TokenType) Token {
+	char, line := s.char, s.line
+	s.append()
+
+	if pair, exists := pairs[s.read()]; exists {
+		Type = pair
+		s.append()
+	}
+
+	return Token{
+		Type: Type,
+		Val:  string(s.buf),
+		Char: char,
+		Line: line,
+	}
+}
+
 func (s *Scanner) readWord() Token {
 	char, line := s.char, s.line
 	for {
@@ -182,6 +307,54 @@ func (s *Scanner) readWord() Token {
 	case "BY":
 		result.Type = By
 		result.Val = word
+	case "AS":
+		result.Type = As
+		result.Val = word
+	case "AND":
+		result.Type = And
+		result.Val = word
+	case "OR":
+		result.Type = Or
+		result.Val = word
+	case "NOT":
+		result.Type = Not
+		result.Val = word
+	case "JOIN":
+		result.Type = Join
+		result.Val = word
+	case "ON":
+		result.Type = On
+		result.Val = word
+	case "INNER":
+		result.Type = Inner
+		result.Val = word
+	case "LEFT":
+		result.Type = Left
+		result.Val = word
+	case "RIGHT":
+		result.Type = Right
+		result.Val = word
+	case "FULL":
+		result.Type = Full
+		result.Val = word
+	case "OUTER":
+		result.Type = Outer
+		result.Val = word
+	case "ORDER":
+		result.Type = Order
+		result.Val = word
+	case "ASC":
+		result.Type = Asc
+		result.Val = word
+	case "DESC":
+		result.Type = Desc
+		result.Val = word
+	case "LIMIT":
+		result.Type = Limit
+		result.Val = word
+	case "OFFSET":
+		result.Type = Offset
+		result.Val = word
 	case "TRUE":
 		result.Type = Boolean
 		result.Val = true
@@ -196,36 +369,55 @@ func (s *Scanner) readWord() Token {
 	return result
 }
 
-func (s *Scanner) readInteger() Token {
-	current := s.read()
+func (s *Scanner) readNumber() Token {
+	s.read()
 	char, line := s.char, s.line
 	s.append()
+	s.readDigits()
 
-	for {
-		current = s.read()
-		if !isNumeric(current) {
-			break
-		}
+	isFloat := false
+	if s.read() == '.' && s.peekDigit(0) {
+		isFloat = true
 		s.append()
+		s.readDigits()
 	}
 
-	intStr := string(s.buf)
-	parsed, err := strconv.Atoi(intStr)
-	if err != nil {
-		return Token{
-			Type: UnknownToken,
-			Val:  intStr,
-			Char: char,
-			Line: line,
+	if current := s.read(); (current == 'e' || current == 'E') && (s.peekDigit(0) || (s.peekSign(0) && s.peekDigit(1))) {
+		isFloat = true
+		s.append()
+		if current = s.read(); current == '+' || current == '-' {
+			s.append()
 		}
+		s.readDigits()
 	}
 
-	return Token{
-		Type: Integer,
-		Val:  parsed,
+	numStr := string(s.buf)
+	result := Token{
 		Char: char,
 		Line: line,
 	}
+
+	var err error
+	if isFloat {
+		result.Type = Float
+		result.Val, err = strconv.ParseFloat(numStr, 64)
+	} else {
+		result.Type = Integer
+		result.Val, err = strconv.Atoi(numStr)
+	}
+
+	if err != nil {
+		result.Type = UnknownToken
+		result.Val = numStr
+	}
+
+	return result
+}
+
+func (s *Scanner) readDigits() {
+	for isNumeric(s.read()) {
+		s.append()
+	}
 }
 
 func (s *Scanner) readString() Token {
@@ -235,7 +427,15 @@ func (s *Scanner) readString() Token {
 
 	for {
 		current = s.read()
-		if current == '"' {
+		if s.err != nil {
+			// The input ended before the closing quote.
+			return Token{
+				Type: InvalidString,
+				Val:  string(s.buf),
+				Char: char,
+				Line: line,
+			}
+		} else if current == '"' {
 			s.discard()
 			return Token{
 				Type: String,
@@ -264,6 +464,17 @@ func (s *Scanner) readString() Token {
 	}
 }
 
+// peekDigit and peekSign look past the held rune without consuming input.
+func (s *Scanner) peekDigit(n int) bool {
+	next, err := s.reader.Peek(n + 1)
+	return err == nil && isNumeric(rune(next[n]))
+}
+
+func (s *Scanner) peekSign(n int) bool {
+	next, err := s.reader.Peek(n + 1)
+	return err == nil && (next[n] == '+' || next[n] == '-')
+}
+
 func (s *Scanner) clear() {
 	s.buf = s.buf[:0]
 }
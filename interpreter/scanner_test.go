@@ -23,9 +23,53 @@ func TestScannerPunctuation(t *testing.T) {
 	}
 }
 
+func TestScannerOperators(t *testing.T) {
+	input := bufio.NewReader(strings.NewReader("= != <> < <= > >= + - * / % <>="))
+	expected := []TokenType{
+		Equal, NotEqual, NotEqual, Less, LessEqual, Greater, GreaterEqual,
+		Plus, Minus, Asterisk, Slash, Percent, NotEqual, Equal,
+	}
+
+	scanner := NewScanner(input)
+	for i, expected := range expected {
+		actual := scanner.Next()
+		if actual.Type != expected {
+			t.Fatalf("#%d\nexpected: %v\n  actual: %v", i, expected, actual)
+		}
+	}
+
+	if actual := scanner.Next(); actual.Type != EOF {
+		t.Fatalf("\nexpected: EOF\n  actual: %v", actual)
+	}
+}
+
+func TestScannerMinus(t *testing.T) {
+	input := bufio.NewReader(strings.NewReader("a-1 -2<!"))
+	expected := []Token{
+		{Type: Identifier, Val: "a", Line: 0, Char: 0},
+		{Type: Minus, Val: "-", Line: 0, Char: 1},
+		{Type: Integer, Val: 1, Line: 0, Char: 2},
+		{Type: Minus, Val: "-", Line: 0, Char: 4},
+		{Type: Integer, Val: 2, Line: 0, Char: 5},
+		{Type: Less, Val: "<", Line: 0, Char: 6},
+		{Type: UnknownToken, Val: "!", Line: 0, Char: 7},
+	}
+
+	scanner := NewScanner(input)
+	for i, expected := range expected {
+		if actual := scanner.Next(); actual != expected {
+			t.Fatalf("#%d\nexpected: %v\n  actual: %v", i, expected, actual)
+		}
+	}
+
+	if actual := scanner.Next(); actual.Type != EOF {
+		t.Fatalf("\nexpected: EOF\n  actual: %v", actual)
+	}
+}
+
 func TestScannerKeywords(t *testing.T) {
-	input := bufio.NewReader(strings.NewReader("SELECT FROM WHERE GROUP BY"))
-	expected := []TokenType{Select, From, Where, Group, By}
+	input := bufio.NewReader(strings.NewReader("SELECT FROM WHERE GROUP BY AS AND OR NOT JOIN ON INNER LEFT RIGHT FULL OUTER ORDER ASC DESC LIMIT OFFSET"))
+	expected := []TokenType{Select, From, Where, Group, By, As, And, Or, Not, Join, On, Inner, Left, Right, Full, Outer, Order, Asc, Desc, Limit, Offset}
 
 	scanner := NewScanner(input)
 	for i, expected := range expected {
@@ -58,8 +102,8 @@ func TestScannerIdentifier(t *testing.T) {
 }
 
 func TestScannerInteger(t *testing.T) {
-	input := bufio.NewReader(strings.NewReader("123 -9 0"))
-	expected := []int{123, -9, 0}
+	input := bufio.NewReader(strings.NewReader("123 9 0"))
+	expected := []int{123, 9, 0}
 
 	scanner := NewScanner(input)
 	for i, expected := range expected {
@@ -74,6 +118,49 @@ func TestScannerInteger(t *testing.T) {
 	}
 }
 
+func TestScannerFloat(t *testing.T) {
+	input := bufio.NewReader(strings.NewReader("12.5 0.25 1e3 2.5E-2 7e+1"))
+	expected := []float64{12.5, 0.25, 1e3, 2.5e-2, 7e+1}
+
+	scanner := NewScanner(input)
+	for i, expected := range expected {
+		actual := scanner.Next()
+		if actual.Type != Float || actual.Val.(float64) != expected {
+			t.Fatalf("#%d\nexpected: %v\n  actual: %v", i, expected, actual)
+		}
+	}
+
+	if actual := scanner.Next(); actual.Type != EOF {
+		t.Fatalf("\nexpected: EOF\n  actual: %v", actual)
+	}
+}
+
+func TestScannerNumberSuffix(t *testing.T) {
+	input := bufio.NewReader(strings.NewReader("12.a 3e 4e-x"))
+	expected := []Token{
+		{Type: Integer, Val: 12, Line: 0, Char: 0},
+		{Type: Period, Val: ".", Line: 0, Char: 2},
+		{Type: Identifier, Val: "a", Line: 0, Char: 3},
+		{Type: Integer, Val: 3, Line: 0, Char: 5},
+		{Type: Identifier, Val: "e", Line: 0, Char: 6},
+		{Type: Integer, Val: 4, Line: 0, Char: 8},
+		{Type: Identifier, Val: "e", Line: 0, Char: 9},
+		{Type: Minus, Val: "-", Line: 0, Char: 10},
+		{Type: Identifier, Val: "x", Line: 0, Char: 11},
+	}
+
+	scanner := NewScanner(input)
+	for i, expected := range expected {
+		if actual := scanner.Next(); actual != expected {
+			t.Fatalf("#%d\nexpected: %v\n  actual: %v", i, expected, actual)
+		}
+	}
+
+	if actual := scanner.Next(); actual.Type != EOF {
+		t.Fatalf("\nexpected: EOF\n  actual: %v", actual)
+	}
+}
+
 func TestScannerString(t *testing.T) {
 	input := bufio.NewReader(strings.NewReader(`"foo""\\\"\n"`))
 	expected := []string{"foo", "\\\"\n"}
@@ -107,3 +194,20 @@ func TestScannerBoolean(t *testing.T) {
 		t.Fatalf("\nexpected: EOF\n  actual: %v", actual)
 	}
 }
+
+func TestScannerPosition(t *testing.T) {
+	input := bufio.NewReader(strings.NewReader("SELECT a\n  FROM b"))
+	expected := []Token{
+		{Type: Select, Val: "SELECT", Line: 0, Char: 0},
+		{Type: Identifier, Val: "a", Line: 0, Char: 7},
+		{Type: From, Val: "FROM", Line: 1, Char: 2},
+		{Type: Identifier, Val: "b", Line: 1, Char: 7},
+	}
+
+	scanner := NewScanner(input)
+	for i, expected := range expected {
+		if actual := scanner.Next(); actual != expected {
+			t.Fatalf("#%d\nexpected: %v\n  actual: %v", i, expected, actual)
+		}
+	}
+}
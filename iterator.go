@@ -1,6 +1,32 @@
 package shred
 
+import (
+	"io"
+)
+
+// Iterator is a source of records. Next returns a nil record once the source
+// is exhausted. Iterators that hold resources, such as database rows, should
+// also implement io.Closer so that datasets can release them early.
 type Iterator interface {
 	Clone() Iterator
 	Next() (Record, error)
 }
+
+// closeIterator closes it if it holds resources, i.e. implements io.Closer.
+func closeIterator(it Iterator) error {
+	if closer, ok := it.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// closeIterators closes each iterator and returns the first error.
+func closeIterators(its ...Iterator) error {
+	var err error
+	for _, it := range its {
+		if closeErr := closeIterator(it); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
@@ -35,3 +35,32 @@ func (f *FailingIterator) Clone() Iterator {
 func (f *FailingIterator) Next() (Record, error) {
 	return nil, ErrFailingIterator
 }
+
+// ClosingIterator records how it is used across all of its clones.
+type ClosingIterator struct {
+	records RecordIterator
+	stats   *iteratorStats
+}
+
+type iteratorStats struct {
+	next   int
+	closed int
+}
+
+func NewClosingIterator(records ...Record) *ClosingIterator {
+	return &ClosingIterator{records: records, stats: &iteratorStats{}}
+}
+
+func (c *ClosingIterator) Clone() Iterator {
+	return &ClosingIterator{records: *c.records.Clone().(*RecordIterator), stats: c.stats}
+}
+
+func (c *ClosingIterator) Next() (Record, error) {
+	c.stats.next++
+	return c.records.Next()
+}
+
+func (c *ClosingIterator) Close() error {
+	c.stats.closed++
+	return nil
+}
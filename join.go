@@ -0,0 +1,617 @@
+package shred
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrJoinKeys = errors.New("shred: join requires the same number of keys on both sides")
+	ErrUnsorted = errors.New("shred: merge join input is not sorted on the join keys")
+)
+
+type ColumnConflictError struct {
+	Column string
+	Left   interface{}
+	Right  interface{}
+}
+
+func (e *ColumnConflictError) Error() string {
+	return fmt.Sprintf("shred: conflicting values for column %q: %v and %v", e.Column, e.Left, e.Right)
+}
+
+type JoinType int
+
+const (
+	JoinInner JoinType = iota
+	JoinLeft
+	JoinRight
+	JoinFull
+	JoinSemi
+	JoinAnti
+)
+
+// ConflictPolicy decides which value is kept when both sides of a join have
+// a column of the same name.
+type ConflictPolicy int
+
+const (
+	ConflictKeepRight ConflictPolicy = iota
+	ConflictKeepLeft
+	ConflictError
+)
+
+type joinConfig struct {
+	leftPrefix  string
+	rightPrefix string
+	conflict    ConflictPolicy
+	// keyFn compares conflicting values like join keys, so that the key
+	// columns of records matched through normalization don't conflict.
+	keyFn func(interface{}) interface{}
+}
+
+type JoinOption func(*joinConfig)
+
+// JoinPrefixes qualifies the columns of each side, e.g. with "users." and
+// "orders.", before records are merged.
+func JoinPrefixes(left, right string) JoinOption {
+	return func(c *joinConfig) {
+		c.leftPrefix = left
+		c.rightPrefix = right
+	}
+}
+
+// JoinConflict sets the policy for columns present on both sides. The default
+// keeps the right value, like Record.Merge. ConflictError only fails when the
+// two values differ as join keys would, so "1" and 1 agree unless the dataset
+// uses strict keys.
+func JoinConflict(policy ConflictPolicy) JoinOption {
+	return func(c *joinConfig) {
+		c.conflict = policy
+	}
+}
+
+func newJoinConfig(opts []JoinOption, keyFn func(interface{}) interface{}) joinConfig {
+	config := joinConfig{keyFn: keyFn}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return config
+}
+
+func (c joinConfig) merge(left, right Record) (Record, error) {
+	merged := make(Record, len(left)+len(right))
+	for k, v := range left {
+		merged[c.leftPrefix+k] = v
+	}
+
+	for k, v := range right {
+		k = c.rightPrefix + k
+		if existing, exists := merged[k]; exists {
+			switch c.conflict {
+			case ConflictKeepLeft:
+				continue
+			case ConflictError:
+				if c.keyFn(existing) != c.keyFn(v) {
+					return nil, &ColumnConflictError{Column: k, Left: existing, Right: v}
+				}
+			}
+		}
+		merged[k] = v
+	}
+
+	return merged, nil
+}
+
+func prefixed(rec Record, prefix string) Record {
+	if prefix == "" {
+		return rec
+	}
+
+	out := make(Record, len(rec))
+	for k, v := range rec {
+		out[prefix+k] = v
+	}
+	return out
+}
+
+func (d *Dataset) InnerJoin(lKey, rKey string, right Iterator, opts ...JoinOption) *Dataset {
+	return d.Join(JoinInner, []string{lKey}, []string{rKey}, right, opts...)
+}
+
+func (d *Dataset) InnerJoinKeys(lKeys, rKeys []string, right Iterator, opts ...JoinOption) *Dataset {
+	return d.Join(JoinInner, lKeys, rKeys, right, opts...)
+}
+
+func (d *Dataset) LeftJoin(lKey, rKey string, right Iterator, opts ...JoinOption) *Dataset {
+	return d.Join(JoinLeft, []string{lKey}, []string{rKey}, right, opts...)
+}
+
+func (d *Dataset) RightJoin(lKey, rKey string, right Iterator, opts ...JoinOption) *Dataset {
+	return d.Join(JoinRight, []string{lKey}, []string{rKey}, right, opts...)
+}
+
+func (d *Dataset) FullOuterJoin(lKey, rKey string, right Iterator, opts ...JoinOption) *Dataset {
+	return d.Join(JoinFull, []string{lKey}, []string{rKey}, right, opts...)
+}
+
+func (d *Dataset) SemiJoin(lKey, rKey string, right Iterator, opts ...JoinOption) *Dataset {
+	return d.Join(JoinSemi, []string{lKey}, []string{rKey}, right, opts...)
+}
+
+func (d *Dataset) AntiJoin(lKey, rKey string, right Iterator, opts ...JoinOption) *Dataset {
+	return d.Join(JoinAnti, []string{lKey}, []string{rKey}, right, opts...)
+}
+
+// Join matches records of d against records of right whose key columns are
+// equal. Records without a match on the other side are emitted as they are,
+// without the other side's columns, for the outer join types. Semi and anti
+// joins emit each left record at most once and never include right columns.
+// As in SQL, a nil or missing key matches nothing, not even another nil key.
+//
+// The right side is held in memory. If it exceeds the memory budget, both
+// sides are partitioned by key to temporary files and each partition is
+// joined on its own, in which case records are no longer emitted in the order
+// of the left side.
+func (d *Dataset) Join(joinType JoinType, lKeys, rKeys []string, right Iterator, opts ...JoinOption) *Dataset {
+	spec := &joinSpec{
+		joinType: joinType,
+		lKeys:    lKeys,
+		rKeys:    rKeys,
+		keyFn:    d.keyFunc(),
+		config:   newJoinConfig(opts, d.keyFunc()),
+		budget:   d.budget(),
+	}
+
+	return d.operate(func() operator {
+		var joined, rightInput Iterator
+		return operator{
+			next: func(iterator Iterator) (Record, error) {
+				if len(lKeys) != len(rKeys) {
+					return nil, ErrJoinKeys
+				}
+
+				if joined == nil {
+					rightInput = bindContext(right.Clone(), contextOf(iterator))
+					var err error
+					if joined, err = spec.hashJoin(iterator, rightInput, 0); err != nil {
+						return nil, err
+					}
+				}
+
+				return joined.Next()
+			},
+			close: func() error {
+				return closeIterators(rightInput, joined)
+			},
+		}
+	}).includeCaches(right)
+}
+
+type joinSpec struct {
+	joinType JoinType
+	lKeys    []string
+	rKeys    []string
+	keyFn    func(interface{}) interface{}
+	config   joinConfig
+	budget   int64
+}
+
+func (s *joinSpec) keepLeft() bool {
+	return s.joinType == JoinLeft || s.joinType == JoinFull
+}
+
+func (s *joinSpec) keepRight() bool {
+	return s.joinType == JoinRight || s.joinType == JoinFull
+}
+
+// hashJoin builds a hash table of the right side, falling back to a grace hash
+// join once the table exceeds the memory budget.
+func (s *joinSpec) hashJoin(left, right Iterator, depth int) (Iterator, error) {
+	j := &joinIterator{
+		spec:     s,
+		left:     left,
+		rightMap: make(map[interface{}][]Record),
+		matched:  make(map[interface{}]bool),
+	}
+
+	var size int64
+	for {
+		next, err := right.Next()
+		if err != nil {
+			return nil, err
+		} else if next == nil {
+			return j, nil
+		}
+
+		// Records with a NULL key never match, so they are only kept to be
+		// emitted unmatched.
+		switch {
+		case !nullKey(next, s.rKeys):
+			val := groupKey(next, s.rKeys, s.keyFn)
+			if _, exists := j.rightMap[val]; !exists {
+				j.rightOrder = append(j.rightOrder, val)
+			}
+			j.rightMap[val] = append(j.rightMap[val], next)
+		case s.keepRight():
+			j.nullRight = append(j.nullRight, next)
+		default:
+			continue
+		}
+
+		if size += recordSize(next); size > s.budget && depth < maxSpillDepth {
+			return s.graceJoin(j, left, right, depth)
+		}
+	}
+}
+
+// graceJoin partitions the right records built so far, the rest of the right
+// side and the whole left side by key, then joins each partition separately.
+func (s *joinSpec) graceJoin(built *joinIterator, left, right Iterator, depth int) (Iterator, error) {
+	rightParts, err := createSpillFiles(spillPartitions)
+	if err != nil {
+		return nil, err
+	}
+
+	leftParts, err := createSpillFiles(spillPartitions)
+	if err != nil {
+		removeSpillFiles(rightParts)
+		return nil, err
+	}
+
+	fail := func(err error) (Iterator, error) {
+		removeSpillFiles(rightParts)
+		removeSpillFiles(leftParts)
+		return nil, err
+	}
+
+	for _, val := range built.rightOrder {
+		for _, rec := range built.rightMap[val] {
+			if err := rightParts[partitionOf(val, depth)].Write(rec); err != nil {
+				return fail(err)
+			}
+		}
+	}
+	for _, rec := range built.nullRight {
+		if err := rightParts[partitionOf(nil, depth)].Write(rec); err != nil {
+			return fail(err)
+		}
+	}
+
+	if err := partitionRecords(right, rightParts, s.rKeys, s.keyFn, depth); err != nil {
+		return fail(err)
+	}
+	if err := partitionRecords(left, leftParts, s.lKeys, s.keyFn, depth); err != nil {
+		return fail(err)
+	}
+	if err := rewindSpillFiles(rightParts); err != nil {
+		return fail(err)
+	}
+	if err := rewindSpillFiles(leftParts); err != nil {
+		return fail(err)
+	}
+
+	return newPartitionIterator(func(files []*spillFile) (Iterator, error) {
+		return s.hashJoin(files[0], files[1], depth+1)
+	}, leftParts, rightParts), nil
+}
+
+func partitionRecords(input Iterator, partitions []*spillFile, keys []string, keyFn func(interface{}) interface{}, depth int) error {
+	for {
+		next, err := input.Next()
+		if err != nil {
+			return err
+		} else if next == nil {
+			return nil
+		}
+
+		val := groupKey(next, keys, keyFn)
+		if err := partitions[partitionOf(val, depth)].Write(next); err != nil {
+			return err
+		}
+	}
+}
+
+// joinIterator probes the left side against the right side held in memory.
+type joinIterator struct {
+	spec         *joinSpec
+	left         Iterator
+	rightMap     map[interface{}][]Record
+	rightOrder   []interface{}
+	nullRight    []Record
+	matched      map[interface{}]bool
+	currentLeft  Record
+	currentRight []Record
+	leftDone     bool
+	unmatched    []Record
+}
+
+func (j *joinIterator) Clone() Iterator {
+	panic("shred: join iterator cannot be cloned")
+}
+
+func (j *joinIterator) Next() (Record, error) {
+	s := j.spec
+	for len(j.currentRight) == 0 {
+		if j.leftDone {
+			if len(j.unmatched) == 0 {
+				return nil, nil
+			}
+
+			next := j.unmatched[0]
+			j.unmatched = j.unmatched[1:]
+			return prefixed(next, s.config.rightPrefix), nil
+		}
+
+		next, err := j.left.Next()
+		if err != nil {
+			return nil, err
+		} else if next == nil {
+			j.leftDone = true
+			if s.keepRight() {
+				for _, val := range j.rightOrder {
+					if !j.matched[val] {
+						j.unmatched = append(j.unmatched, j.rightMap[val]...)
+					}
+				}
+				j.unmatched = append(j.unmatched, j.nullRight...)
+			}
+			continue
+		}
+
+		var (
+			val     interface{}
+			matches []Record
+			found   bool
+		)
+		if !nullKey(next, s.lKeys) {
+			val = groupKey(next, s.lKeys, s.keyFn)
+			matches, found = j.rightMap[val]
+		}
+		switch {
+		case s.joinType == JoinSemi && found, s.joinType == JoinAnti && !found:
+			return prefixed(next, s.config.leftPrefix), nil
+		case s.joinType == JoinSemi, s.joinType == JoinAnti:
+			continue
+		case found:
+			j.matched[val] = true
+			j.currentLeft = next
+			j.currentRight = matches
+		case s.keepLeft():
+			return prefixed(next, s.config.leftPrefix), nil
+		}
+	}
+
+	next, err := s.config.merge(j.currentLeft, j.currentRight[0])
+	if err != nil {
+		return nil, err
+	}
+
+	j.currentRight = j.currentRight[1:]
+	return next, nil
+}
+
+// MergeJoin joins d and right like Join, but expects both sides to already be
+// sorted in ascending order on their join keys, e.g. with OrderBy, or SortInt
+// for integer keys. Only the records sharing the current right key are held in
+// memory. Keys are compared like OrderBy compares values, so numeric strings
+// compare as numbers and 1, 1.0 and "1" all match. ErrUnsorted is returned if
+// either side turns out not to be sorted, e.g. numeric strings ordered as text
+// with SortString.
+func (d *Dataset) MergeJoin(joinType JoinType, lKeys, rKeys []string, right Iterator, opts ...JoinOption) *Dataset {
+	spec := &joinSpec{
+		joinType: joinType,
+		lKeys:    lKeys,
+		rKeys:    rKeys,
+		config:   newJoinConfig(opts, d.keyFunc()),
+	}
+
+	return d.operate(func() operator {
+		var joined *mergeJoinIterator
+		return operator{
+			next: func(iterator Iterator) (Record, error) {
+				if len(lKeys) != len(rKeys) {
+					return nil, ErrJoinKeys
+				}
+
+				if joined == nil {
+					rightInput := bindContext(right.Clone(), contextOf(iterator))
+					joined = &mergeJoinIterator{spec: spec, left: iterator, right: rightInput}
+				}
+
+				return joined.Next()
+			},
+			close: func() error {
+				if joined == nil {
+					return nil
+				}
+				return closeIterator(joined.right)
+			},
+		}
+	}).includeCaches(right)
+}
+
+type mergeJoinIterator struct {
+	spec         *joinSpec
+	left         Iterator
+	right        Iterator
+	peek         Record
+	rightDone    bool
+	group        []Record
+	groupKey     []interface{}
+	groupMatched bool
+	prevLeft     []interface{}
+	leftDone     bool
+	currentLeft  Record
+	currentRight []Record
+	unmatched    []Record
+}
+
+func (j *mergeJoinIterator) Clone() Iterator {
+	panic("shred: merge join iterator cannot be cloned")
+}
+
+func (j *mergeJoinIterator) Next() (Record, error) {
+	s := j.spec
+	for len(j.currentRight) == 0 {
+		if len(j.unmatched) > 0 {
+			next := j.unmatched[0]
+			j.unmatched = j.unmatched[1:]
+			return prefixed(next, s.config.rightPrefix), nil
+		}
+
+		if j.leftDone {
+			if !s.keepRight() {
+				return nil, nil
+			}
+			if j.group == nil {
+				if err := j.loadGroup(); err != nil {
+					return nil, err
+				} else if j.group == nil {
+					return nil, nil
+				}
+			}
+			if err := j.skipGroup(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		next, err := j.left.Next()
+		if err != nil {
+			return nil, err
+		} else if next == nil {
+			j.leftDone = true
+			continue
+		}
+
+		val := keyValues(next, s.lKeys)
+		if j.prevLeft != nil && compareKeys(val, j.prevLeft) < 0 {
+			return nil, ErrUnsorted
+		}
+		j.prevLeft = val
+
+		for {
+			if j.group == nil {
+				if err := j.loadGroup(); err != nil {
+					return nil, err
+				} else if j.group == nil {
+					break
+				}
+			}
+			if compareKeys(j.groupKey, val) >= 0 {
+				break
+			}
+			if err := j.skipGroup(); err != nil {
+				return nil, err
+			}
+		}
+
+		found := j.group != nil && compareKeys(j.groupKey, val) == 0 && !nullKey(next, s.lKeys)
+		switch {
+		case s.joinType == JoinSemi && found, s.joinType == JoinAnti && !found:
+			return prefixed(next, s.config.leftPrefix), nil
+		case s.joinType == JoinSemi, s.joinType == JoinAnti:
+			continue
+		case found:
+			j.groupMatched = true
+			j.currentLeft = next
+			j.currentRight = j.group
+		case s.keepLeft():
+			return prefixed(next, s.config.leftPrefix), nil
+		}
+	}
+
+	next, err := s.config.merge(j.currentLeft, j.currentRight[0])
+	if err != nil {
+		return nil, err
+	}
+
+	j.currentRight = j.currentRight[1:]
+	return next, nil
+}
+
+// skipGroup moves past the current right group, queueing its records if they
+// never matched and the join keeps unmatched right records.
+func (j *mergeJoinIterator) skipGroup() error {
+	if j.group == nil {
+		if err := j.loadGroup(); err != nil || j.group == nil {
+			return err
+		}
+	}
+
+	if j.spec.keepRight() && !j.groupMatched {
+		j.unmatched = append(j.unmatched, j.group...)
+	}
+	j.group = nil
+	return nil
+}
+
+// loadGroup reads the next run of right records sharing the same key.
+func (j *mergeJoinIterator) loadGroup() error {
+	if j.peek == nil && !j.rightDone {
+		next, err := j.right.Next()
+		if err != nil {
+			return err
+		}
+		j.peek, j.rightDone = next, next == nil
+	}
+	if j.peek == nil {
+		return nil
+	}
+
+	val := keyValues(j.peek, j.spec.rKeys)
+	if j.groupKey != nil && compareKeys(val, j.groupKey) < 0 {
+		return ErrUnsorted
+	}
+
+	j.group, j.groupKey, j.groupMatched = []Record{j.peek}, val, false
+	j.peek = nil
+	for {
+		next, err := j.right.Next()
+		if err != nil {
+			return err
+		} else if next == nil {
+			j.rightDone = true
+			return nil
+		}
+
+		switch c := compareKeys(keyValues(next, j.spec.rKeys), val); {
+		case c < 0:
+			return ErrUnsorted
+		case c == 0:
+			j.group = append(j.group, next)
+		default:
+			j.peek = next
+			return nil
+		}
+	}
+}
+
+// nullKey reports whether any of the keys of rec is nil or missing. Like
+// NULLs in SQL, such keys never match, not even each other.
+func nullKey(rec Record, keys []string) bool {
+	for _, key := range keys {
+		if rec.Get(key) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func keyValues(rec Record, keys []string) []interface{} {
+	vals := make([]interface{}, len(keys))
+	for i, key := range keys {
+		vals[i] = rec.Get(key)
+	}
+	return vals
+}
+
+func compareKeys(a, b []interface{}) int {
+	for i := range a {
+		if c := compareValues(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
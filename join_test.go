@@ -0,0 +1,394 @@
+package shred
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func joinInputs() (*RecordIterator, *RecordIterator) {
+	users := &RecordIterator{
+		{"user_id": 1, "name": "John"},
+		{"user_id": 2, "name": "Jane"},
+		{"user_id": 3, "name": "Jack"},
+	}
+	orders := &RecordIterator{
+		{"uid": 1, "order_id": 1},
+		{"uid": 4, "order_id": 2},
+		{"uid": 1, "order_id": 3},
+		{"uid": 2, "order_id": 4},
+		{"uid": 5, "order_id": 5},
+	}
+	return users, orders
+}
+
+func TestDatasetJoinTypes(t *testing.T) {
+	tests := []struct {
+		joinType JoinType
+		expected []Record
+	}{
+		{JoinInner, []Record{
+			{"user_id": 1, "name": "John", "uid": 1, "order_id": 1},
+			{"user_id": 1, "name": "John", "uid": 1, "order_id": 3},
+			{"user_id": 2, "name": "Jane", "uid": 2, "order_id": 4},
+		}},
+		{JoinLeft, []Record{
+			{"user_id": 1, "name": "John", "uid": 1, "order_id": 1},
+			{"user_id": 1, "name": "John", "uid": 1, "order_id": 3},
+			{"user_id": 2, "name": "Jane", "uid": 2, "order_id": 4},
+			{"user_id": 3, "name": "Jack"},
+		}},
+		{JoinRight, []Record{
+			{"user_id": 1, "name": "John", "uid": 1, "order_id": 1},
+			{"user_id": 1, "name": "John", "uid": 1, "order_id": 3},
+			{"user_id": 2, "name": "Jane", "uid": 2, "order_id": 4},
+			{"uid": 4, "order_id": 2},
+			{"uid": 5, "order_id": 5},
+		}},
+		{JoinFull, []Record{
+			{"user_id": 1, "name": "John", "uid": 1, "order_id": 1},
+			{"user_id": 1, "name": "John", "uid": 1, "order_id": 3},
+			{"user_id": 2, "name": "Jane", "uid": 2, "order_id": 4},
+			{"user_id": 3, "name": "Jack"},
+			{"uid": 4, "order_id": 2},
+			{"uid": 5, "order_id": 5},
+		}},
+		{JoinSemi, []Record{
+			{"user_id": 1, "name": "John"},
+			{"user_id": 2, "name": "Jane"},
+		}},
+		{JoinAnti, []Record{
+			{"user_id": 3, "name": "Jack"},
+		}},
+	}
+
+	for i, test := range tests {
+		users, orders := joinInputs()
+		actual, err := NewDataset(users).Join(test.joinType, []string{"user_id"}, []string{"uid"}, orders).Collect()
+
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if !reflect.DeepEqual(test.expected, actual) {
+			t.Fatalf("#%d\nexpected: %v\nactual: %v", i, test.expected, actual)
+		}
+	}
+}
+
+func TestDatasetJoinShorthands(t *testing.T) {
+	users, orders := joinInputs()
+	customers, err := NewDataset(users).SemiJoin("user_id", "uid", orders).Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users, orders = joinInputs()
+	noOrders, err := NewDataset(users).AntiJoin("user_id", "uid", orders).Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users, orders = joinInputs()
+	left, err := NewDataset(users).LeftJoin("user_id", "uid", orders).Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users, orders = joinInputs()
+	right, err := NewDataset(users).RightJoin("user_id", "uid", orders).Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users, orders = joinInputs()
+	full, err := NewDataset(users).FullOuterJoin("user_id", "uid", orders).Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(customers) != 2 || len(noOrders) != 1 || len(left) != 4 || len(right) != 5 || len(full) != 6 {
+		t.Fatalf("unexpected: %v %v %v %v %v", customers, noOrders, left, right, full)
+	}
+}
+
+func TestDatasetJoinErrorPropagation(t *testing.T) {
+	users, _ := joinInputs()
+	for joinType := JoinInner; joinType <= JoinAnti; joinType++ {
+		_, err := NewDataset(users.Clone()).Join(joinType, []string{"user_id"}, []string{"uid"}, new(FailingIterator)).Collect()
+		if err != ErrFailingIterator {
+			t.Fatalf("%d: unexpected error: %v", joinType, err)
+		}
+
+		_, err = NewDataset(new(FailingIterator)).Join(joinType, []string{"user_id"}, []string{"uid"}, users.Clone()).Collect()
+		if err != ErrFailingIterator {
+			t.Fatalf("%d: unexpected error: %v", joinType, err)
+		}
+	}
+}
+
+func TestDatasetJoinPrefixes(t *testing.T) {
+	users := &RecordIterator{
+		{"id": 1, "created_at": "2016-01-01"},
+		{"id": 2, "created_at": "2016-01-02"},
+	}
+	orders := &RecordIterator{
+		{"id": 10, "user_id": 1, "created_at": "2016-02-01"},
+		{"id": 11, "user_id": 3, "created_at": "2016-02-02"},
+	}
+	expected := []Record{
+		{"users.id": 1, "users.created_at": "2016-01-01", "orders.id": 10, "orders.user_id": 1, "orders.created_at": "2016-02-01"},
+		{"users.id": 2, "users.created_at": "2016-01-02"},
+		{"orders.id": 11, "orders.user_id": 3, "orders.created_at": "2016-02-02"},
+	}
+
+	actual, err := NewDataset(users).FullOuterJoin("id", "user_id", orders, JoinPrefixes("users.", "orders.")).Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected: %v\nactual: %v", expected, actual)
+	}
+}
+
+func TestDatasetJoinConflict(t *testing.T) {
+	left := &RecordIterator{{"id": 1, "name": "left"}}
+	right := &RecordIterator{{"id": 1, "name": "right"}}
+
+	tests := []struct {
+		opts     []JoinOption
+		expected []Record
+		err      error
+	}{
+		{nil, []Record{{"id": 1, "name": "right"}}, nil},
+		{[]JoinOption{JoinConflict(ConflictKeepRight)}, []Record{{"id": 1, "name": "right"}}, nil},
+		{[]JoinOption{JoinConflict(ConflictKeepLeft)}, []Record{{"id": 1, "name": "left"}}, nil},
+		{[]JoinOption{JoinConflict(ConflictError)}, nil, &ColumnConflictError{Column: "name", Left: "left", Right: "right"}},
+		{[]JoinOption{JoinConflict(ConflictError), JoinPrefixes("", "r_")}, []Record{{"id": 1, "name": "left", "r_id": 1, "r_name": "right"}}, nil},
+	}
+
+	for i, test := range tests {
+		actual, err := NewDataset(left.Clone()).InnerJoin("id", "id", right.Clone(), test.opts...).Collect()
+
+		if !reflect.DeepEqual(test.err, err) {
+			t.Fatalf("#%d unexpected error: %v", i, err)
+		}
+		if !reflect.DeepEqual(test.expected, actual) {
+			t.Fatalf("#%d\nexpected: %v\nactual: %v", i, test.expected, actual)
+		}
+	}
+}
+
+func TestDatasetJoinConflictNormalizedKeys(t *testing.T) {
+	left := &RecordIterator{{"user_id": "1", "name": "John"}}
+	right := &RecordIterator{{"user_id": 1, "total": 25}, {"user_id": int64(1), "name": "Jane"}}
+	expected := []Record{
+		{"user_id": 1, "name": "John", "total": 25},
+	}
+
+	_, err := NewDataset(left.Clone()).InnerJoin("user_id", "user_id", right.Clone(), JoinConflict(ConflictError)).Collect()
+
+	// The key columns agree, so only the name conflicts.
+	expectedErr := &ColumnConflictError{Column: "name", Left: "John", Right: "Jane"}
+	if !reflect.DeepEqual(expectedErr, err) {
+		t.Fatalf("expected: %v\nactual: %v", expectedErr, err)
+	}
+
+	actual, err := NewDataset(left.Clone()).InnerJoin("user_id", "user_id", NewDataset(right.Clone()).Limit(1), JoinConflict(ConflictError)).Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected: %v\nactual: %v", expected, actual)
+	}
+}
+
+func TestDatasetJoinNormalizedKeys(t *testing.T) {
+	mysql := &RecordIterator{
+		{"user_id": "1", "first_name": "John"},
+		{"user_id": "2", "first_name": "Jane"},
+	}
+	cassandra := &RecordIterator{
+		{"uid": 1, "total_price": 25},
+		{"uid": int64(2), "total_price": 11},
+	}
+	expected := []Record{
+		{"user_id": "1", "first_name": "John", "uid": 1, "total_price": 25},
+		{"user_id": "2", "first_name": "Jane", "uid": int64(2), "total_price": 11},
+	}
+
+	actual, err := NewDataset(mysql.Clone()).InnerJoin("user_id", "uid", cassandra.Clone()).Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected: %v\nactual: %v", expected, actual)
+	}
+
+	actual, err = NewDataset(mysql.Clone()).StrictKeys(true).InnerJoin("user_id", "uid", cassandra.Clone()).Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actual) != 0 {
+		t.Fatalf("unexpected: %v", actual)
+	}
+}
+
+func recordStrings(recs []Record) []string {
+	strs := make([]string, len(recs))
+	for i, rec := range recs {
+		strs[i] = fmt.Sprint(map[string]interface{}(rec))
+	}
+	sort.Strings(strs)
+	return strs
+}
+
+func TestDatasetJoinNullKeys(t *testing.T) {
+	// Both sides are sorted on their keys, NULLs first, for MergeJoin.
+	users := RecordIterator{
+		{"user_id": nil, "name": "Nil"},
+		{"name": "Missing"},
+		{"user_id": 1, "name": "John"},
+	}
+	orders := RecordIterator{
+		{"uid": nil, "order_id": 1},
+		{"order_id": 2},
+		{"uid": 1, "order_id": 3},
+	}
+
+	matched := Record{"user_id": 1, "name": "John", "uid": 1, "order_id": 3}
+	tests := []struct {
+		joinType JoinType
+		expected []Record
+	}{
+		{JoinInner, []Record{matched}},
+		{JoinLeft, []Record{users[0], users[1], matched}},
+		{JoinRight, []Record{matched, orders[0], orders[1]}},
+		{JoinFull, []Record{users[0], users[1], matched, orders[0], orders[1]}},
+		{JoinSemi, []Record{users[2]}},
+		{JoinAnti, []Record{users[0], users[1]}},
+	}
+
+	joins := map[string]func(JoinType) *Dataset{
+		"hash": func(joinType JoinType) *Dataset {
+			return NewDataset(users.Clone()).Join(joinType, []string{"user_id"}, []string{"uid"}, orders.Clone())
+		},
+		"grace": func(joinType JoinType) *Dataset {
+			return NewDataset(users.Clone()).MemoryBudget(1).Join(joinType, []string{"user_id"}, []string{"uid"}, orders.Clone())
+		},
+		"merge": func(joinType JoinType) *Dataset {
+			return NewDataset(users.Clone()).MergeJoin(joinType, []string{"user_id"}, []string{"uid"}, orders.Clone())
+		},
+	}
+
+	for name, join := range joins {
+		for _, test := range tests {
+			actual, err := join(test.joinType).Collect()
+
+			if err != nil {
+				t.Fatalf("%s join type %d: %v", name, test.joinType, err)
+			}
+			if !reflect.DeepEqual(recordStrings(test.expected), recordStrings(actual)) {
+				t.Fatalf("%s join type %d\nexpected: %v\nactual: %v", name, test.joinType, test.expected, actual)
+			}
+		}
+	}
+}
+
+func TestDatasetGraceJoin(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", dir)
+
+	users, orders := RecordIterator{}, RecordIterator{}
+	for i := 0; i < 200; i++ {
+		users = append(users, Record{"user_id": i, "name": fmt.Sprint("user", i)})
+	}
+	for i := 0; i < 500; i++ {
+		orders = append(orders, Record{"uid": (i * 7) % 250, "order_id": i})
+	}
+
+	for _, joinType := range []JoinType{JoinInner, JoinLeft, JoinRight, JoinFull, JoinSemi, JoinAnti} {
+		expected, err := NewDataset(users.Clone()).Join(joinType, []string{"user_id"}, []string{"uid"}, orders.Clone()).Collect()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		actual, err := NewDataset(users.Clone()).MemoryBudget(20000).Join(joinType, []string{"user_id"}, []string{"uid"}, orders.Clone()).Collect()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(recordStrings(expected), recordStrings(actual)) {
+			t.Fatalf("join type %d\nexpected: %v\nactual: %v", joinType, expected, actual)
+		}
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Fatalf("expected spill files to be removed, found %d", len(files))
+	}
+}
+
+func TestDatasetMergeJoin(t *testing.T) {
+	for _, joinType := range []JoinType{JoinInner, JoinLeft, JoinRight, JoinFull, JoinSemi, JoinAnti} {
+		users, orders := joinInputs()
+		expected, err := NewDataset(users).Join(joinType, []string{"user_id"}, []string{"uid"}, orders).Collect()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		users, orders = joinInputs()
+		sortedOrders := NewDataset(orders).SortInt("uid")
+		actual, err := NewDataset(users).MergeJoin(joinType, []string{"user_id"}, []string{"uid"}, sortedOrders).Collect()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(recordStrings(expected), recordStrings(actual)) {
+			t.Fatalf("join type %d\nexpected: %v\nactual: %v", joinType, expected, actual)
+		}
+	}
+}
+
+func TestDatasetMergeJoinUnsorted(t *testing.T) {
+	users, orders := joinInputs()
+
+	_, err := NewDataset(users).MergeJoin(JoinInner, []string{"user_id"}, []string{"uid"}, orders).Collect()
+
+	if err != ErrUnsorted {
+		t.Fatalf("expected: %v\nactual: %v", ErrUnsorted, err)
+	}
+}
+
+func TestDatasetMergeJoinNumericStrings(t *testing.T) {
+	users := &RecordIterator{
+		{"id": "10", "name": "John"},
+		{"id": "9", "name": "Jane"},
+		{"id": "100", "name": "Jack"},
+	}
+	orders := &RecordIterator{
+		{"uid": "100", "order_id": 1},
+		{"uid": "9", "order_id": 2},
+		{"uid": "9", "order_id": 3},
+	}
+	expected := []Record{
+		{"id": "9", "name": "Jane", "uid": "9", "order_id": 2},
+		{"id": "9", "name": "Jane", "uid": "9", "order_id": 3},
+		{"id": "100", "name": "Jack", "uid": "100", "order_id": 1},
+	}
+
+	sortedOrders := NewDataset(orders).SortInt("uid")
+	actual, err := NewDataset(users).SortInt("id").MergeJoin(JoinInner, []string{"id"}, []string{"uid"}, sortedOrders).Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected: %v\nactual: %v", expected, actual)
+	}
+}
@@ -0,0 +1,98 @@
+package shred
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+// compositeKey chains the values of several columns into a single comparable
+// map key. Two keys are equal exactly when every column value is equal.
+type compositeKey struct {
+	head interface{}
+	tail interface{}
+}
+
+// uncomparableKey stands in for values such as slices and maps, which would
+// panic if used as a map key, by their type and formatted contents.
+type uncomparableKey struct {
+	typ  string
+	repr string
+}
+
+func groupKey(rec Record, keys []string, keyFn func(interface{}) interface{}) interface{} {
+	if len(keys) == 1 {
+		return keyFn(rec.Get(keys[0]))
+	}
+
+	var key interface{}
+	for i := len(keys) - 1; i >= 0; i-- {
+		key = compositeKey{head: keyFn(rec.Get(keys[i])), tail: key}
+	}
+
+	return key
+}
+
+func hashable(v interface{}) interface{} {
+	if v == nil || reflect.ValueOf(v).Comparable() {
+		return v
+	}
+
+	return uncomparableKey{typ: fmt.Sprintf("%T", v), repr: fmt.Sprintf("%#v", v)}
+}
+
+// normalizeKey maps numerically equal values to the same key, whatever their
+// type: integers of any width, integral floats and numeric strings all become
+// an int64, other floats and fractional numeric strings a float64. Byte
+// slices are treated as strings.
+func normalizeKey(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return normalizeString(v)
+	case []byte:
+		return normalizeString(string(v))
+	case float64:
+		return normalizeFloat(v)
+	case float32:
+		return normalizeFloat(float64(v))
+	case uint:
+		return normalizeUint(uint64(v))
+	case uint64:
+		return normalizeUint(v)
+	}
+
+	if i, ok := toInt64(v); ok {
+		return i
+	}
+
+	return hashable(v)
+}
+
+func normalizeString(s string) interface{} {
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i
+	}
+
+	if f, err := strconv.ParseFloat(s, 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+		return normalizeFloat(f)
+	}
+
+	return s
+}
+
+func normalizeFloat(f float64) interface{} {
+	if f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+		return int64(f)
+	}
+
+	return f
+}
+
+func normalizeUint(u uint64) interface{} {
+	if u <= math.MaxInt64 {
+		return int64(u)
+	}
+
+	return u
+}
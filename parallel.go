@@ -0,0 +1,191 @@
+package shred
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicError is returned when a transformation running on another goroutine,
+// such as a parallel or pipelined one, panics.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("shred: panic in transformation: %v", e.Value)
+}
+
+type parallelConfig struct {
+	unordered bool
+}
+
+type ParallelOption func(*parallelConfig)
+
+// Unordered lets a parallel transformation emit records as soon as they are
+// processed instead of in input order.
+func Unordered() ParallelOption {
+	return func(c *parallelConfig) {
+		c.unordered = true
+	}
+}
+
+func newParallelConfig(opts []ParallelOption) parallelConfig {
+	var config parallelConfig
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return config
+}
+
+// ParallelMap is like Map, but runs fn on up to workers records at a time.
+// Records are emitted in input order unless the Unordered option is given.
+func (d *Dataset) ParallelMap(workers int, fn func(Record) Record, opts ...ParallelOption) *Dataset {
+	return d.parallel(workers, func(r Record) (Record, bool) {
+		return fn(r), true
+	}, newParallelConfig(opts))
+}
+
+// ParallelFilter is like Filter, but runs fn on up to workers records at a
+// time. Records are emitted in input order unless the Unordered option is
+// given.
+func (d *Dataset) ParallelFilter(workers int, fn func(Record) bool, opts ...ParallelOption) *Dataset {
+	return d.parallel(workers, func(r Record) (Record, bool) {
+		return r, fn(r)
+	}, newParallelConfig(opts))
+}
+
+func (d *Dataset) parallel(workers int, fn func(Record) (Record, bool), config parallelConfig) *Dataset {
+	if workers < 1 {
+		workers = 1
+	}
+
+	return d.operate(func() operator {
+		var p *parallelIterator
+		return operator{
+			next: func(iterator Iterator) (Record, error) {
+				if p == nil {
+					p = startParallel(iterator, workers, fn, config)
+				}
+
+				return p.Next()
+			},
+			close: func() error {
+				if p != nil {
+					p.stop()
+				}
+				return nil
+			},
+		}
+	})
+}
+
+// parallelIterator reads its input on one goroutine and hands records out to
+// a pool of workers. At most a window of records is in flight, so a slow
+// record holds back the reader rather than letting results pile up.
+type parallelIterator struct {
+	*goroutines
+	window    chan struct{}
+	unordered bool
+	pending   map[int]result
+	next      int
+	stopped   bool
+}
+
+func startParallel(input Iterator, workers int, fn func(Record) (Record, bool), config parallelConfig) *parallelIterator {
+	p := &parallelIterator{
+		goroutines: newGoroutines(workers),
+		window:     make(chan struct{}, 4*workers),
+		unordered:  config.unordered,
+		pending:    make(map[int]result),
+	}
+
+	jobs := make(chan result, workers)
+	p.start(func() { p.feed(input, jobs) })
+	for i := 0; i < workers; i++ {
+		p.start(func() { p.work(jobs, fn) })
+	}
+	p.closeWhenDone()
+
+	return p
+}
+
+func (p *parallelIterator) feed(input Iterator, jobs chan<- result) {
+	defer close(jobs)
+
+	for seq := 0; ; seq++ {
+		select {
+		case p.window <- struct{}{}:
+		case <-p.done:
+			return
+		}
+
+		next, err := input.Next()
+		if err != nil {
+			p.send(result{seq: seq, err: err})
+			return
+		} else if next == nil {
+			return
+		}
+
+		select {
+		case jobs <- result{seq: seq, rec: next}:
+		case <-p.done:
+			return
+		}
+	}
+}
+
+func (p *parallelIterator) work(jobs <-chan result, fn func(Record) (Record, bool)) {
+	for job := range jobs {
+		if !p.send(apply(fn, job)) {
+			return
+		}
+	}
+}
+
+func apply(fn func(Record) (Record, bool), job result) (r result) {
+	defer func() {
+		if v := recover(); v != nil {
+			r = result{seq: job.seq, err: &PanicError{Value: v, Stack: debug.Stack()}}
+		}
+	}()
+
+	rec, keep := fn(job.rec)
+	return result{seq: job.seq, rec: rec, keep: keep}
+}
+
+func (p *parallelIterator) Clone() Iterator {
+	panic("shred: parallel iterator cannot be cloned")
+}
+
+func (p *parallelIterator) Next() (Record, error) {
+	for !p.stopped {
+		r, ok := p.pending[p.next]
+		if ok {
+			delete(p.pending, p.next)
+		} else if r, ok = <-p.results; !ok {
+			return nil, nil
+		} else if r.err != nil {
+			// Errors end the iteration, so they aren't held back for order.
+			p.stop()
+			return nil, r.err
+		} else if !p.unordered && r.seq != p.next {
+			p.pending[r.seq] = r
+			continue
+		}
+
+		p.next++
+		<-p.window
+		if r.keep {
+			return r.rec, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (p *parallelIterator) stop() {
+	p.stopped = true
+	p.goroutines.stop()
+}
@@ -0,0 +1,122 @@
+package shred
+
+import (
+	"reflect"
+	"runtime"
+	"sort"
+	"testing"
+	"time"
+)
+
+func parallelInput(n int) *RecordIterator {
+	input := RecordIterator{}
+	for i := 0; i < n; i++ {
+		input = append(input, Record{"foo": i})
+	}
+	return &input
+}
+
+func TestDatasetParallelMap(t *testing.T) {
+	expected := []Record{}
+	for i := 0; i < 200; i++ {
+		expected = append(expected, Record{"foo": i, "bar": i * 2})
+	}
+
+	actual, err := NewDataset(parallelInput(200)).ParallelMap(8, func(r Record) Record {
+		// Later records finish first.
+		time.Sleep(time.Duration(200-r.Int("foo")) * time.Microsecond)
+		return r.Set("bar", r.Int("foo")*2)
+	}).Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected: %v\nactual: %v", expected, actual)
+	}
+}
+
+func TestDatasetParallelMapUnordered(t *testing.T) {
+	expected := []int{}
+	for i := 0; i < 200; i++ {
+		expected = append(expected, i*2)
+	}
+
+	recs, err := NewDataset(parallelInput(200)).ParallelMap(8, func(r Record) Record {
+		return r.Set("bar", r.Int("foo")*2)
+	}, Unordered()).Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual := []int{}
+	for _, rec := range recs {
+		actual = append(actual, rec.Int("bar"))
+	}
+	sort.Ints(actual)
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected: %v\nactual: %v", expected, actual)
+	}
+}
+
+func TestDatasetParallelFilter(t *testing.T) {
+	expected := []Record{}
+	for i := 0; i < 200; i += 3 {
+		expected = append(expected, Record{"foo": i})
+	}
+
+	actual, err := NewDataset(parallelInput(200)).ParallelFilter(4, func(r Record) bool {
+		return r.Int("foo")%3 == 0
+	}).Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected: %v\nactual: %v", expected, actual)
+	}
+}
+
+func TestDatasetParallelErrors(t *testing.T) {
+	_, err := NewDataset(parallelInput(10)).Union(&FailingIterator{}).ParallelMap(4, func(r Record) Record {
+		return r
+	}).Collect()
+
+	if err != ErrFailingIterator {
+		t.Fatalf("expected: %v\nactual: %v", ErrFailingIterator, err)
+	}
+
+	_, err = NewDataset(parallelInput(10)).ParallelFilter(4, func(r Record) bool {
+		if r.Int("foo") == 5 {
+			panic("boom")
+		}
+		return true
+	}).Collect()
+
+	if perr, ok := err.(*PanicError); !ok || perr.Value != "boom" {
+		t.Fatalf("expected a panic error, found %v", err)
+	}
+}
+
+func TestDatasetParallelClose(t *testing.T) {
+	before := runtime.NumGoroutine()
+	input := NewClosingIterator(*parallelInput(1000)...)
+
+	actual, err := NewDataset(input).ParallelMap(4, func(r Record) Record {
+		return r
+	}).Limit(3).Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actual) != 3 || input.stats.closed == 0 {
+		t.Fatalf("expected 3 records and a close, found %d records and %d closes", len(actual), input.stats.closed)
+	}
+
+	for i := 0; runtime.NumGoroutine() > before; i++ {
+		if i == 100 {
+			t.Fatalf("expected goroutines to exit, found %d more", runtime.NumGoroutine()-before)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
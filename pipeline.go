@@ -0,0 +1,101 @@
+package shred
+
+import (
+	"context"
+)
+
+// Prefetch reads the records of the dataset on a separate goroutine, up to
+// buffer records ahead of the consumer, so that producing the records
+// overlaps with consuming them.
+func (d *Dataset) Prefetch(buffer int) *Dataset {
+	return &Dataset{
+		input:    newPrefetchIterator(d.Clone(), buffer),
+		settings: d.settings,
+	}
+}
+
+// Pipelined runs every stage of the dataset, from its sources to the last
+// transformation, on its own goroutine. Stages are connected by channels of
+// buffer records, so a stage blocks once it is that far ahead of the next.
+// The last stage still runs on the goroutine that calls Next.
+func (d *Dataset) Pipelined(buffer int) *Dataset {
+	clone := d.configure()
+	if input, ok := d.input.(*Dataset); ok {
+		clone.input = input.Pipelined(buffer)
+	}
+	clone.input = newPrefetchIterator(clone.input, buffer)
+	return clone
+}
+
+// prefetchIterator pulls from its input on a goroutine, started by the first
+// call to Next, into a bounded channel.
+type prefetchIterator struct {
+	*goroutines
+	input    Iterator
+	buffer   int
+	finished bool
+}
+
+func newPrefetchIterator(input Iterator, buffer int) *prefetchIterator {
+	if buffer < 0 {
+		buffer = 0
+	}
+
+	return &prefetchIterator{input: input, buffer: buffer}
+}
+
+func (p *prefetchIterator) Clone() Iterator {
+	return newPrefetchIterator(p.input.Clone(), p.buffer)
+}
+
+func (p *prefetchIterator) WithContext(ctx context.Context) Iterator {
+	return newPrefetchIterator(bindContext(p.input, ctx), p.buffer)
+}
+
+func (p *prefetchIterator) Next() (Record, error) {
+	if p.finished {
+		return nil, nil
+	}
+
+	if p.goroutines == nil {
+		p.goroutines = newGoroutines(p.buffer)
+		p.start(p.run)
+		p.closeWhenDone()
+	}
+
+	r, ok := <-p.results
+	if !ok {
+		p.finished = true
+		return nil, nil
+	} else if r.err != nil {
+		p.finished = true
+		p.stop()
+		return nil, r.err
+	}
+
+	return r.rec, nil
+}
+
+func (p *prefetchIterator) run() {
+	for {
+		next, err := p.input.Next()
+		if err != nil {
+			p.send(result{err: err})
+			return
+		} else if next == nil || !p.send(result{rec: next}) {
+			return
+		}
+	}
+}
+
+func (p *prefetchIterator) stop() {
+	if p.goroutines != nil {
+		p.goroutines.stop()
+	}
+}
+
+func (p *prefetchIterator) Close() error {
+	p.finished = true
+	p.stop()
+	return closeIterator(p.input)
+}
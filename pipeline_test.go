@@ -0,0 +1,93 @@
+package shred
+
+import (
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// CountingIterator counts the calls to Next across its clones.
+type CountingIterator struct {
+	RecordIterator
+	calls *int64
+}
+
+func (c *CountingIterator) Clone() Iterator {
+	return &CountingIterator{RecordIterator: *c.RecordIterator.Clone().(*RecordIterator), calls: c.calls}
+}
+
+func (c *CountingIterator) Next() (Record, error) {
+	atomic.AddInt64(c.calls, 1)
+	return c.RecordIterator.Next()
+}
+
+func TestDatasetPipelined(t *testing.T) {
+	calls := int64(0)
+	input := &CountingIterator{RecordIterator: *parallelInput(20), calls: &calls}
+	expected := []Record{}
+	for i := 0; i < 20; i += 2 {
+		expected = append(expected, Record{"foo": i})
+	}
+
+	actual, err := NewDataset(input).Map(func(r Record) Record {
+		// Only returns once the source has moved on to the next record, which
+		// cannot happen when stages run in lock-step.
+		for deadline := time.Now().Add(time.Second); atomic.LoadInt64(&calls) < int64(r.Int("foo")+2); {
+			if time.Now().After(deadline) {
+				t.Error("stages did not overlap")
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		return r
+	}).Filter(func(r Record) bool {
+		return r.Int("foo")%2 == 0
+	}).Pipelined(1).Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected: %v\nactual: %v", expected, actual)
+	}
+}
+
+func TestDatasetPrefetchBackpressure(t *testing.T) {
+	calls := int64(0)
+	input := &CountingIterator{RecordIterator: *parallelInput(100), calls: &calls}
+
+	dataset := NewDataset(input).Prefetch(2)
+	if _, err := dataset.Next(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	// One record consumed, two buffered and one waiting to be sent.
+	if n := atomic.LoadInt64(&calls); n > 4 {
+		t.Fatalf("expected at most 4 reads, found %d", n)
+	}
+	if err := dataset.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDatasetPipelinedErrors(t *testing.T) {
+	_, err := NewDataset(parallelInput(5)).Union(&FailingIterator{}).Map(func(r Record) Record {
+		return r
+	}).Pipelined(4).Collect()
+
+	if err != ErrFailingIterator {
+		t.Fatalf("expected: %v\nactual: %v", ErrFailingIterator, err)
+	}
+
+	_, err = NewDataset(parallelInput(5)).Map(func(r Record) Record {
+		panic("boom")
+	}).Map(func(r Record) Record {
+		return r
+	}).Pipelined(4).Collect()
+
+	if perr, ok := err.(*PanicError); !ok || perr.Value != "boom" {
+		t.Fatalf("expected a panic error, found %v", err)
+	}
+}
@@ -40,6 +40,31 @@ func (r Record) IntOr(key string, or int) int {
 	return or
 }
 
+func (r Record) Float(key string) float64 {
+	v := r.Get(key)
+	switch v := v.(type) {
+	case string:
+		f, _ := strconv.ParseFloat(v, 64)
+		return f
+	default:
+		f, _ := toFloat(v)
+		return f
+	}
+}
+
+func (r Record) FloatOr(key string, or float64) float64 {
+	v := r.Get(key)
+	if s, ok := v.(string); ok {
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	} else if f, ok := toFloat(v); ok {
+		return f
+	}
+
+	return or
+}
+
 func (r Record) String(key string) string {
 	v := r.Get(key)
 	switch v := v.(type) {
@@ -47,6 +72,10 @@ func (r Record) String(key string) string {
 		return v
 	case int:
 		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
 	default:
 		return ""
 	}
@@ -58,6 +58,42 @@ func TestRecordAccess(t *testing.T) {
 	}
 }
 
+func TestRecordFloat(t *testing.T) {
+	rec := Record{
+		"float":   12.5,
+		"float32": float32(0.5),
+		"int":     5,
+		"numeric": "1.25e2",
+		"string":  "foo",
+	}
+
+	tests := []struct {
+		key      string
+		float    float64
+		floatOr  float64
+		asString string
+	}{
+		{"float", 12.5, 12.5, "12.5"},
+		{"float32", 0.5, 0.5, "0.5"},
+		{"int", 5, 5, "5"},
+		{"numeric", 125, 125, "1.25e2"},
+		{"string", 0, 42, "foo"},
+		{"non-existent", 0, 42, ""},
+	}
+
+	for i, test := range tests {
+		if actual := rec.Float(test.key); actual != test.float {
+			t.Fatalf("#%d unexpected: %v", i, actual)
+		}
+		if actual := rec.FloatOr(test.key, 42); actual != test.floatOr {
+			t.Fatalf("#%d unexpected: %v", i, actual)
+		}
+		if actual := rec.String(test.key); actual != test.asString {
+			t.Fatalf("#%d unexpected: %v", i, actual)
+		}
+	}
+}
+
 func TestRecordSetClone(t *testing.T) {
 	a := Record{
 		"foo": "bar",
@@ -0,0 +1,301 @@
+package shred
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/maphash"
+)
+
+// maxSpillDepth bounds how many times a spilled partition that still exceeds
+// the memory budget is split again. Past it, the partition is reduced in
+// memory regardless of the budget.
+const maxSpillDepth = 4
+
+// hashReduce reduces the records of input that share the same key. Partial
+// results are held in memory until they exceed the budget, at which point they
+// are hashed by key into spill partitions. Each partition is then reduced on
+// its own, so every key is reduced exactly once in input order.
+func hashReduce(input Iterator, keys []string, keyFn func(interface{}) interface{}, fn func(a, b Record) Record, budget int64, depth int) (Iterator, error) {
+	var (
+		partitions []*spillFile
+		size       int64
+	)
+	keyed := map[interface{}]*reduceState{}
+
+	for {
+		next, err := input.Next()
+		if err != nil {
+			removeSpillFiles(partitions)
+			return nil, err
+		} else if next == nil {
+			break
+		}
+
+		key := groupKey(next, keys, keyFn)
+		if state, exists := keyed[key]; exists {
+			size += state.merge(fn, next)
+		} else {
+			state = newReduceState(next)
+			keyed[key] = state
+			size += state.size
+		}
+		if size <= budget || depth == maxSpillDepth {
+			continue
+		}
+
+		if partitions == nil {
+			if partitions, err = createSpillFiles(spillPartitions); err != nil {
+				return nil, err
+			}
+		}
+		if err := spillKeyed(keyed, partitions, depth); err != nil {
+			removeSpillFiles(partitions)
+			return nil, err
+		}
+
+		keyed, size = map[interface{}]*reduceState{}, 0
+	}
+
+	if partitions == nil {
+		acc := make([]Record, 0, len(keyed))
+		for _, state := range keyed {
+			acc = append(acc, state.rec)
+		}
+		return newSliceIterator(acc), nil
+	}
+
+	if err := spillKeyed(keyed, partitions, depth); err != nil {
+		removeSpillFiles(partitions)
+		return nil, err
+	}
+	if err := rewindSpillFiles(partitions); err != nil {
+		removeSpillFiles(partitions)
+		return nil, err
+	}
+
+	return newPartitionIterator(func(files []*spillFile) (Iterator, error) {
+		return hashReduce(files[0], keys, keyFn, fn, budget, depth+1)
+	}, partitions), nil
+}
+
+// reduceState is the partial result of a key. Its size is an upper bound on
+// the memory it holds: each merge may grow the result by at most the size of
+// the merged record, so that is added until the growth could have doubled
+// the last measurement. Only then is the result measured again, which keeps
+// accumulators such as Collect from being re-measured on every record.
+type reduceState struct {
+	rec      Record
+	measured int64
+	size     int64
+}
+
+func newReduceState(rec Record) *reduceState {
+	size := recordSize(rec)
+	return &reduceState{rec: rec, measured: size, size: size}
+}
+
+// merge reduces rec into the state and returns the change in its size.
+func (s *reduceState) merge(fn func(a, b Record) Record, rec Record) int64 {
+	before := s.size
+	s.rec = fn(s.rec, rec)
+	if s.size += recordSize(rec); s.size > 2*s.measured {
+		s.measured = recordSize(s.rec)
+		s.size = s.measured
+	}
+	return s.size - before
+}
+
+func spillKeyed(keyed map[interface{}]*reduceState, partitions []*spillFile, depth int) error {
+	for key, state := range keyed {
+		if err := partitions[partitionOf(key, depth)].Write(state.rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParallelReduceByKey is like ReduceByKey, but reduces with up to workers
+// goroutines.
+func (d *Dataset) ParallelReduceByKey(workers int, key string, fn func(a, b Record) Record) *Dataset {
+	return d.ParallelReduceByKeys(workers, []string{key}, fn)
+}
+
+// ParallelReduceByKeys is like ReduceByKeys, but shards the records by key
+// across workers goroutines, each reducing its own keys within its share of
+// the memory budget. The records of a key are still reduced in input order.
+func (d *Dataset) ParallelReduceByKeys(workers int, keys []string, fn func(a, b Record) Record) *Dataset {
+	if workers < 1 {
+		workers = 1
+	}
+
+	keyFn := d.keyFunc()
+	budget := d.budget() / int64(workers)
+	reduce := func(shard Iterator) (Iterator, error) {
+		return hashReduce(shard, keys, keyFn, fn, budget, 0)
+	}
+	key := func(rec Record) interface{} {
+		return groupKey(rec, keys, keyFn)
+	}
+
+	return d.operate(func() operator {
+		var s *shardedReduce
+		return operator{
+			next: func(iterator Iterator) (Record, error) {
+				if s == nil {
+					s = startShardedReduce(iterator, workers, reduce, key)
+				}
+
+				return s.Next()
+			},
+			close: func() error {
+				if s != nil {
+					s.stop()
+				}
+				return nil
+			},
+		}
+	})
+}
+
+var errShardStopped = errors.New("shred: shard stopped")
+
+// shardedReduce dispatches the records of its input to one channel per
+// worker, by key, and gathers the reduced records of every worker.
+type shardedReduce struct {
+	*goroutines
+	seed    maphash.Seed
+	stopped bool
+}
+
+func startShardedReduce(input Iterator, workers int, reduce func(Iterator) (Iterator, error), key func(Record) interface{}) *shardedReduce {
+	s := &shardedReduce{
+		goroutines: newGoroutines(workers),
+		seed:       maphash.MakeSeed(),
+	}
+
+	shards := make([]chan Record, workers)
+	for i := range shards {
+		shards[i] = make(chan Record, 64)
+	}
+
+	s.start(func() { s.dispatch(input, shards, key) })
+	for _, shard := range shards {
+		shard := &shardIterator{records: shard, done: s.done}
+		s.start(func() { s.work(shard, reduce) })
+	}
+	s.closeWhenDone()
+
+	return s
+}
+
+func (s *shardedReduce) dispatch(input Iterator, shards []chan Record, key func(Record) interface{}) {
+	defer func() {
+		for _, shard := range shards {
+			close(shard)
+		}
+	}()
+
+	for {
+		next, err := input.Next()
+		if err != nil {
+			s.send(result{err: err})
+			return
+		} else if next == nil {
+			return
+		}
+
+		select {
+		case shards[s.shardOf(key(next), len(shards))] <- next:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *shardedReduce) work(shard Iterator, reduce func(Iterator) (Iterator, error)) {
+	reduced, err := reduce(shard)
+	if err == errShardStopped {
+		return
+	} else if err != nil {
+		s.send(result{err: err})
+		return
+	}
+	defer closeIterator(reduced)
+
+	for {
+		next, err := reduced.Next()
+		if err != nil {
+			s.send(result{err: err})
+			return
+		} else if next == nil || !s.send(result{rec: next}) {
+			return
+		}
+	}
+}
+
+func (s *shardedReduce) Next() (Record, error) {
+	if s.stopped {
+		return nil, nil
+	}
+
+	r, ok := <-s.results
+	if !ok {
+		return nil, nil
+	} else if r.err != nil {
+		s.stop()
+		return nil, r.err
+	}
+
+	return r.rec, nil
+}
+
+func (s *shardedReduce) stop() {
+	s.stopped = true
+	s.goroutines.stop()
+}
+
+func (s *shardedReduce) shardOf(key interface{}, n int) int {
+	var h maphash.Hash
+	h.SetSeed(s.seed)
+	writeKey(&h, key)
+	return int(h.Sum64() % uint64(n))
+}
+
+// writeKey hashes the common key types directly and falls back to their
+// formatted representation.
+func writeKey(h *maphash.Hash, key interface{}) {
+	switch key := key.(type) {
+	case string:
+		h.WriteString(key)
+	case int64:
+		var buf [8]byte
+		binary.LittleEndian.PutUint64(buf[:], uint64(key))
+		h.Write(buf[:])
+	case compositeKey:
+		writeKey(h, key.head)
+		h.WriteByte(0)
+		writeKey(h, key.tail)
+	default:
+		fmt.Fprintf(h, "%#v", key)
+	}
+}
+
+// shardIterator reads the records dispatched to a worker.
+type shardIterator struct {
+	records <-chan Record
+	done    <-chan struct{}
+}
+
+func (s *shardIterator) Clone() Iterator {
+	panic("shred: shard iterator cannot be cloned")
+}
+
+func (s *shardIterator) Next() (Record, error) {
+	select {
+	case next := <-s.records:
+		return next, nil
+	case <-s.done:
+		return nil, errShardStopped
+	}
+}
@@ -0,0 +1,189 @@
+package shred
+
+import (
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestDatasetReduceByKeySpill(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", dir)
+
+	input := RecordIterator{}
+	for i := 0; i < 1000; i++ {
+		input = append(input, Record{"key": i % 100, "n": 1})
+	}
+	expected := []Record{}
+	for i := 0; i < 100; i++ {
+		expected = append(expected, Record{"key": i, "n": 10})
+	}
+
+	actual, err := NewDataset(&input).MemoryBudget(1000).ReduceByKey("key", func(a, b Record) Record {
+		a["n"] = a["n"].(int) + b["n"].(int)
+		return a
+	}).SortInt("key").Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected: %v\nactual: %v", expected, actual)
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Fatalf("expected spill files to be removed, found %d", len(files))
+	}
+}
+
+func TestAggregateSpillPreservesOrder(t *testing.T) {
+	input := RecordIterator{}
+	for i := 0; i < 300; i++ {
+		input = append(input, Record{"key": i % 30, "seq": i})
+	}
+	expected := []Record{}
+	for i := 0; i < 30; i++ {
+		expected = append(expected, Record{
+			"key":          i,
+			"first(seq)":   i,
+			"last(seq)":    270 + i,
+			"collect(seq)": []interface{}{i, 30 + i, 60 + i, 90 + i, 120 + i, 150 + i, 180 + i, 210 + i, 240 + i, 270 + i},
+		})
+	}
+
+	actual, err := NewDataset(&input).MemoryBudget(1).GroupBy("key").
+		Aggregate(First("seq"), Last("seq"), Collect("seq")).
+		SortInt("key").Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected: %v\nactual: %v", expected, actual)
+	}
+}
+
+func TestAggregateSpillGrowingState(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", dir)
+
+	input := RecordIterator{}
+	for i := 0; i < 1000; i++ {
+		input = append(input, Record{"key": i % 2, "seq": i})
+	}
+	expected := []Record{}
+	for i := 0; i < 2; i++ {
+		seqs := []interface{}{}
+		for seq := i; seq < 1000; seq += 2 {
+			seqs = append(seqs, seq)
+		}
+		expected = append(expected, Record{"key": i, "collect(seq)": seqs})
+	}
+
+	// Only the collected values of the two keys exceed the budget.
+	dataset := NewDataset(&input).MemoryBudget(2000).GroupBy("key").
+		Aggregate(Collect("seq"))
+	defer dataset.Close()
+
+	first, err := dataset.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("expected the collected values to spill")
+	}
+
+	actual := []Record{first}
+	for {
+		next, err := dataset.Next()
+		if err != nil {
+			t.Fatal(err)
+		} else if next == nil {
+			break
+		}
+		actual = append(actual, next)
+	}
+	sort.Slice(actual, func(i, j int) bool {
+		return actual[i].Int("key") < actual[j].Int("key")
+	})
+
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected: %v\nactual: %v", expected, actual)
+	}
+}
+
+func TestDatasetParallelReduceByKeys(t *testing.T) {
+	input := RecordIterator{}
+	for i := 0; i < 1000; i++ {
+		input = append(input, Record{"a": i % 10, "b": i % 7, "n": 1})
+	}
+
+	sum := func(a, b Record) Record {
+		a["n"] = a["n"].(int) + b["n"].(int)
+		return a
+	}
+
+	expected, err := NewDataset(input.Clone()).ReduceByKeys([]string{"a", "b"}, sum).SortInt("a", "b").Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := NewDataset(input.Clone()).ParallelReduceByKeys(4, []string{"a", "b"}, sum).SortInt("a", "b").Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected: %v\nactual: %v", expected, actual)
+	}
+}
+
+func TestAggregateParallel(t *testing.T) {
+	input := RecordIterator{}
+	for i := 0; i < 300; i++ {
+		input = append(input, Record{"key": i % 30, "seq": i})
+	}
+	expected := []Record{}
+	for i := 0; i < 30; i++ {
+		expected = append(expected, Record{"key": i, "first(seq)": i, "last(seq)": 270 + i, "count": 10})
+	}
+
+	actual, err := NewDataset(&input).MemoryBudget(200).GroupBy("key").Parallel(4).
+		Aggregate(First("seq"), Last("seq"), Count("")).
+		SortInt("key").Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected: %v\nactual: %v", expected, actual)
+	}
+}
+
+func TestDatasetParallelReduceByKeyErrors(t *testing.T) {
+	_, err := NewDataset(parallelInput(10)).Union(&FailingIterator{}).ParallelReduceByKey(4, "foo", func(a, b Record) Record {
+		return a
+	}).Collect()
+
+	if err != ErrFailingIterator {
+		t.Fatalf("expected: %v\nactual: %v", ErrFailingIterator, err)
+	}
+
+	input := &RecordIterator{{"foo": 1}, {"foo": 1}}
+	_, err = NewDataset(input).ParallelReduceByKey(4, "foo", func(a, b Record) Record {
+		panic("boom")
+	}).Collect()
+
+	if perr, ok := err.(*PanicError); !ok || perr.Value != "boom" {
+		t.Fatalf("expected a panic error, found %v", err)
+	}
+}
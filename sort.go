@@ -0,0 +1,447 @@
+package shred
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// maxMergeRuns bounds the number of spilled runs that are open, and merged,
+// at once. Sorts with more runs merge them in several passes.
+const maxMergeRuns = 64
+
+func externalSort(input Iterator, fn func([]Record) sort.Interface, budget int64) (Iterator, error) {
+	var (
+		runs []*spillFile
+		buf  []Record
+		size int64
+	)
+
+	for {
+		next, err := input.Next()
+		if err != nil {
+			removeSpillFiles(runs)
+			return nil, err
+		} else if next == nil {
+			break
+		}
+
+		buf = append(buf, next)
+		if size += recordSize(next); size <= budget {
+			continue
+		}
+
+		sort.Stable(fn(buf))
+		run, err := writeRun(newSliceIterator(buf))
+		if err != nil {
+			removeSpillFiles(runs)
+			return nil, err
+		}
+
+		runs = append(runs, run)
+		buf, size = nil, 0
+	}
+
+	sort.Stable(fn(buf))
+	if len(runs) == 0 {
+		return newSliceIterator(buf), nil
+	}
+
+	less := func(a, b Record) bool {
+		return fn([]Record{a, b}).Less(0, 1)
+	}
+
+	// Leave room for the records still in memory in the final merge.
+	for len(runs) >= maxMergeRuns {
+		var err error
+		if runs, err = mergePass(runs, less); err != nil {
+			return nil, err
+		}
+	}
+
+	return mergeRuns(runs, newSliceIterator(buf), less)
+}
+
+// mergePass merges each group of maxMergeRuns consecutive runs into one. The
+// groups keep their order, so the sort stays stable.
+func mergePass(runs []*spillFile, less func(a, b Record) bool) ([]*spillFile, error) {
+	var merged []*spillFile
+	for start := 0; start < len(runs); start += maxMergeRuns {
+		end := start + maxMergeRuns
+		if end > len(runs) {
+			end = len(runs)
+		}
+
+		// The merge removes the runs of the group, even when it fails.
+		m, err := mergeRuns(runs[start:end], nil, less)
+		if err == nil {
+			var run *spillFile
+			run, err = writeRun(m)
+			m.Close()
+			if err == nil {
+				merged = append(merged, run)
+			}
+		}
+		if err != nil {
+			removeSpillFiles(merged)
+			removeSpillFiles(runs[end:])
+			return nil, err
+		}
+	}
+
+	return merged, nil
+}
+
+// mergeRuns merges runs, followed by the sorted records of last if it isn't
+// nil. Each run is removed as soon as it has been read, and the remaining
+// runs when the merge is closed.
+func mergeRuns(runs []*spillFile, last Iterator, less func(a, b Record) bool) (*mergeIterator, error) {
+	sources := make([]Iterator, 0, len(runs)+1)
+	for _, run := range runs {
+		if err := run.Rewind(); err != nil {
+			removeSpillFiles(runs)
+			return nil, err
+		}
+		sources = append(sources, run)
+	}
+	if last != nil {
+		sources = append(sources, last)
+	}
+
+	return newMergeIterator(sources, less, func(i int) {
+		if i < len(runs) {
+			runs[i].Remove()
+		}
+	})
+}
+
+// writeRun writes the records of recs to a parked spill file.
+func writeRun(recs Iterator) (*spillFile, error) {
+	run, err := createSpillFile()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		rec, err := recs.Next()
+		if err == nil && rec == nil {
+			err = run.Park()
+			if err == nil {
+				return run, nil
+			}
+		} else if err == nil {
+			err = run.Write(rec)
+		}
+
+		if err != nil {
+			run.Remove()
+			return nil, err
+		}
+	}
+}
+
+// sliceIterator serves records from memory. It is only used internally by
+// operators and, like their other iterators, cannot be cloned.
+type sliceIterator struct {
+	recs []Record
+}
+
+func newSliceIterator(recs []Record) *sliceIterator {
+	return &sliceIterator{recs: recs}
+}
+
+func (s *sliceIterator) Clone() Iterator {
+	panic("shred: slice iterator cannot be cloned")
+}
+
+func (s *sliceIterator) Next() (Record, error) {
+	if len(s.recs) == 0 {
+		return nil, nil
+	}
+
+	next := s.recs[0]
+	s.recs = s.recs[1:]
+	return next, nil
+}
+
+// mergeIterator merges sorted sources into a single sorted sequence. Records
+// that compare equal are emitted in the order of their sources, which keeps a
+// merge of stable runs stable.
+type mergeIterator struct {
+	sources  []Iterator
+	heads    mergeHeap
+	release  func(i int)
+	released []bool
+}
+
+// newMergeIterator merges sources. release, if not nil, is called once for
+// each source when it is used up or the merge ends early.
+func newMergeIterator(sources []Iterator, less func(a, b Record) bool, release func(i int)) (*mergeIterator, error) {
+	m := &mergeIterator{
+		sources:  sources,
+		heads:    mergeHeap{less: less},
+		release:  release,
+		released: make([]bool, len(sources)),
+	}
+
+	for i, source := range sources {
+		if err := m.push(i, source); err != nil {
+			m.Close()
+			return nil, err
+		}
+	}
+
+	heap.Init(&m.heads)
+	return m, nil
+}
+
+func (m *mergeIterator) Clone() Iterator {
+	panic("shred: merge iterator cannot be cloned")
+}
+
+// Close releases the sources that have not been used up yet.
+func (m *mergeIterator) Close() error {
+	for i := range m.sources {
+		m.releaseSource(i)
+	}
+	m.heads.items = nil
+	return nil
+}
+
+func (m *mergeIterator) Next() (Record, error) {
+	if len(m.heads.items) == 0 {
+		return nil, nil
+	}
+
+	head := heap.Pop(&m.heads).(mergeItem)
+	if err := m.push(head.source, m.sources[head.source]); err != nil {
+		m.Close()
+		return nil, err
+	}
+
+	return head.rec, nil
+}
+
+func (m *mergeIterator) push(i int, source Iterator) error {
+	next, err := source.Next()
+	if err != nil {
+		return err
+	} else if next == nil {
+		m.releaseSource(i)
+	} else {
+		heap.Push(&m.heads, mergeItem{rec: next, source: i})
+	}
+	return nil
+}
+
+func (m *mergeIterator) releaseSource(i int) {
+	if !m.released[i] && m.release != nil {
+		m.release(i)
+	}
+	m.released[i] = true
+}
+
+type mergeItem struct {
+	rec    Record
+	source int
+}
+
+type mergeHeap struct {
+	items []mergeItem
+	less  func(a, b Record) bool
+}
+
+func (h mergeHeap) Len() int {
+	return len(h.items)
+}
+
+func (h mergeHeap) Less(a, b int) bool {
+	x, y := h.items[a], h.items[b]
+	if h.less(x.rec, y.rec) {
+		return true
+	} else if h.less(y.rec, x.rec) {
+		return false
+	}
+	return x.source < y.source
+}
+
+func (h mergeHeap) Swap(a, b int) {
+	h.items[a], h.items[b] = h.items[b], h.items[a]
+}
+
+func (h *mergeHeap) Push(x interface{}) {
+	h.items = append(h.items, x.(mergeItem))
+}
+
+func (h *mergeHeap) Pop() interface{} {
+	last := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return last
+}
+
+// Order is a column to sort by, as built by Asc or Desc. Values are compared
+// by type: numbers numerically whatever their width, then strings and times.
+// Nulls come first in ascending order and last in descending order unless
+// NullsFirst or NullsLast says otherwise.
+type Order struct {
+	column     string
+	desc       bool
+	nullsFirst bool
+}
+
+func Asc(column string) Order {
+	return Order{column: column, nullsFirst: true}
+}
+
+func Desc(column string) Order {
+	return Order{column: column, desc: true}
+}
+
+func (o Order) NullsFirst() Order {
+	o.nullsFirst = true
+	return o
+}
+
+func (o Order) NullsLast() Order {
+	o.nullsFirst = false
+	return o
+}
+
+func (o Order) compare(a, b Record) int {
+	x, y := a.Get(o.column), b.Get(o.column)
+	switch {
+	case x == nil && y == nil:
+		return 0
+	case x == nil && o.nullsFirst, y == nil && !o.nullsFirst:
+		return -1
+	case x == nil, y == nil:
+		return 1
+	case o.desc:
+		return compareValues(y, x)
+	default:
+		return compareValues(x, y)
+	}
+}
+
+// OrderBy sorts the dataset stably by each order in turn.
+func (d *Dataset) OrderBy(orders ...Order) *Dataset {
+	return d.Sort(func(records []Record) sort.Interface {
+		return &orderSorter{records: records, orders: orders}
+	})
+}
+
+type orderSorter struct {
+	records []Record
+	orders  []Order
+}
+
+func (o *orderSorter) Len() int {
+	return len(o.records)
+}
+
+func (o *orderSorter) Less(a, b int) bool {
+	return compareOrders(o.orders, o.records[a], o.records[b]) < 0
+}
+
+func (o *orderSorter) Swap(a, b int) {
+	o.records[a], o.records[b] = o.records[b], o.records[a]
+}
+
+func compareOrders(orders []Order, a, b Record) int {
+	for _, order := range orders {
+		if c := order.compare(a, b); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// TopN emits the first n records of the dataset as ordered by orders, like
+// OrderBy followed by keeping n records, while only holding n records in
+// memory.
+func (d *Dataset) TopN(n int, orders ...Order) *Dataset {
+	return d.TransformFactory(func() func(Iterator) (Record, error) {
+		var top Iterator
+		return func(iterator Iterator) (Record, error) {
+			if top == nil {
+				recs, err := topN(iterator, n, orders)
+				if err != nil {
+					return nil, err
+				}
+				top = newSliceIterator(recs)
+			}
+
+			return top.Next()
+		}
+	})
+}
+
+func topN(input Iterator, n int, orders []Order) ([]Record, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+
+	h := &topHeap{orders: orders}
+	for seq := 0; ; seq++ {
+		next, err := input.Next()
+		if err != nil {
+			return nil, err
+		} else if next == nil {
+			break
+		}
+
+		item := topItem{rec: next, seq: seq}
+		if len(h.items) < n {
+			heap.Push(h, item)
+		} else if h.before(item, h.items[0]) {
+			h.items[0] = item
+			heap.Fix(h, 0)
+		}
+	}
+
+	recs := make([]Record, len(h.items))
+	for i := len(recs) - 1; i >= 0; i-- {
+		recs[i] = heap.Pop(h).(topItem).rec
+	}
+	return recs, nil
+}
+
+type topItem struct {
+	rec Record
+	seq int
+}
+
+// topHeap keeps the records that come last in the order at the top, so that
+// they are the first to be evicted. Ties are broken by input order.
+type topHeap struct {
+	items  []topItem
+	orders []Order
+}
+
+func (h *topHeap) before(a, b topItem) bool {
+	if c := compareOrders(h.orders, a.rec, b.rec); c != 0 {
+		return c < 0
+	}
+	return a.seq < b.seq
+}
+
+func (h *topHeap) Len() int {
+	return len(h.items)
+}
+
+func (h *topHeap) Less(a, b int) bool {
+	return h.before(h.items[b], h.items[a])
+}
+
+func (h *topHeap) Swap(a, b int) {
+	h.items[a], h.items[b] = h.items[b], h.items[a]
+}
+
+func (h *topHeap) Push(x interface{}) {
+	h.items = append(h.items, x.(topItem))
+}
+
+func (h *topHeap) Pop() interface{} {
+	last := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return last
+}
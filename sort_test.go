@@ -0,0 +1,351 @@
+package shred
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+func TestDatasetSortSpill(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", dir)
+
+	input := RecordIterator{}
+	expected := []Record{}
+	for i := 0; i < 100; i++ {
+		input = append(input, Record{"foo": (i * 37) % 10, "seq": i})
+	}
+	for foo := 0; foo < 10; foo++ {
+		for _, rec := range input {
+			if rec["foo"] == foo {
+				expected = append(expected, rec)
+			}
+		}
+	}
+
+	actual, err := NewDataset(&input).MemoryBudget(500).SortInt("foo").Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected: %v\nactual: %v", expected, actual)
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Fatalf("expected spill files to be removed, found %d", len(files))
+	}
+}
+
+func TestDatasetSortManyRuns(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", dir)
+
+	input := RecordIterator{}
+	expected := []Record{}
+	for i := 0; i < 3000; i++ {
+		input = append(input, Record{"foo": (i * 37) % 10, "seq": i})
+	}
+	for foo := 0; foo < 10; foo++ {
+		for _, rec := range input {
+			if rec["foo"] == foo {
+				expected = append(expected, rec)
+			}
+		}
+	}
+
+	// Every record spills to its own run.
+	dataset := NewDataset(&input).MemoryBudget(1).SortInt("foo")
+	defer dataset.Close()
+
+	actual := []Record{}
+	for {
+		next, err := dataset.Next()
+		if err != nil {
+			t.Fatal(err)
+		} else if next == nil {
+			break
+		}
+		actual = append(actual, next)
+
+		if len(actual) == 1 {
+			if fds, err := os.ReadDir("/proc/self/fd"); err == nil && len(fds) > 2*maxMergeRuns {
+				t.Fatalf("expected at most %d open runs, found %d open files", maxMergeRuns, len(fds))
+			}
+		}
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected: %v\nactual: %v", expected, actual)
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Fatalf("expected spill files to be removed, found %d", len(files))
+	}
+}
+
+// point is a value type that is not registered with gob up front.
+type point struct {
+	X, Y int
+}
+
+func TestDatasetSpillValueTypes(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", dir)
+
+	input := RecordIterator{}
+	for i := 0; i < 200; i++ {
+		id, err := gocql.RandomUUID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		input = append(input, Record{"id": id, "group": i % 7, "at": point{X: i, Y: -i}, "tags": []interface{}{id}})
+	}
+
+	expected, err := NewDataset(input.Clone()).SortInt("group").Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual, err := NewDataset(input.Clone()).MemoryBudget(500).SortInt("group").Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected: %v\nactual: %v", expected, actual)
+	}
+
+	distinct, err := NewDataset(input.Clone()).MemoryBudget(500).GroupBy("group").Aggregate(CountDistinct("id")).Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(distinct) != 7 {
+		t.Fatalf("unexpected: %v", distinct)
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Fatalf("expected spill files to be removed, found %d", len(files))
+	}
+}
+
+func TestDatasetSortStringSpill(t *testing.T) {
+	input := &RecordIterator{
+		{"foo": "d"},
+		{"foo": "b"},
+		{"foo": "e"},
+		{"foo": "a"},
+		{"foo": "c"},
+	}
+	expected := []Record{
+		{"foo": "a"},
+		{"foo": "b"},
+		{"foo": "c"},
+		{"foo": "d"},
+		{"foo": "e"},
+	}
+
+	actual, err := NewDataset(input).MemoryBudget(1).SortString("foo").Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected: %v\nactual: %v", expected, actual)
+	}
+}
+
+func TestDatasetMemoryBudgetPropagates(t *testing.T) {
+	input := &RecordIterator{
+		{"foo": 2},
+		{"foo": 1},
+	}
+	expected := []Record{
+		{"foo": 1, "bar": true},
+		{"foo": 2, "bar": true},
+	}
+
+	actual, err := NewDataset(input).MemoryBudget(1).Map(func(r Record) Record {
+		r["bar"] = true
+		return r
+	}).SortInt("foo").Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected: %v\nactual: %v", expected, actual)
+	}
+}
+
+func TestDatasetOrderBy(t *testing.T) {
+	input := &RecordIterator{
+		{"last_name": "Smith", "total_price": 10},
+		{"last_name": "Doe", "total_price": 2.5},
+		{"last_name": "Smith", "total_price": 30},
+		{"last_name": "Doe", "total_price": nil},
+		{"last_name": "Doe", "total_price": 7},
+		{"total_price": 1},
+	}
+	expected := []Record{
+		{"total_price": 1},
+		{"last_name": "Doe", "total_price": 7},
+		{"last_name": "Doe", "total_price": 2.5},
+		{"last_name": "Doe", "total_price": nil},
+		{"last_name": "Smith", "total_price": 30},
+		{"last_name": "Smith", "total_price": 10},
+	}
+
+	actual, err := NewDataset(input).OrderBy(Asc("last_name"), Desc("total_price")).Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected: %v\nactual: %v", expected, actual)
+	}
+}
+
+func TestDatasetOrderByNulls(t *testing.T) {
+	input := &RecordIterator{
+		{"id": 1, "at": time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"id": 2},
+		{"id": 3, "at": time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"id": 4},
+	}
+	tests := []struct {
+		order    Order
+		expected []interface{}
+	}{
+		{Asc("at"), []interface{}{2, 4, 3, 1}},
+		{Asc("at").NullsLast(), []interface{}{3, 1, 2, 4}},
+		{Desc("at"), []interface{}{1, 3, 2, 4}},
+		{Desc("at").NullsFirst(), []interface{}{2, 4, 1, 3}},
+	}
+
+	for i, test := range tests {
+		recs, err := NewDataset(input).OrderBy(test.order).Collect()
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+
+		actual := []interface{}{}
+		for _, rec := range recs {
+			actual = append(actual, rec["id"])
+		}
+		if !reflect.DeepEqual(test.expected, actual) {
+			t.Fatalf("#%d\nexpected: %v\nactual: %v", i, test.expected, actual)
+		}
+	}
+}
+
+func TestDatasetOrderByNumericStrings(t *testing.T) {
+	input := &RecordIterator{
+		{"id": "1", "price": "9"},
+		{"id": "2", "price": "100"},
+		{"id": "3", "price": "n/a"},
+		{"id": "4", "price": "10"},
+		{"id": "5", "price": 9.5},
+	}
+	expected := []interface{}{"3", "2", "4", "5", "1"}
+
+	recs, err := NewDataset(input).OrderBy(Desc("price")).Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual := []interface{}{}
+	for _, rec := range recs {
+		actual = append(actual, rec["id"])
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected: %v\nactual: %v", expected, actual)
+	}
+}
+
+func TestDatasetTopN(t *testing.T) {
+	input := RecordIterator{}
+	for i := 0; i < 100; i++ {
+		input = append(input, Record{"customer": i, "spend": (i * 37) % 20})
+	}
+
+	for _, n := range []int{0, 1, 10, 100, 150} {
+		expected, err := NewDataset(input.Clone()).OrderBy(Desc("spend"), Asc("customer")).Collect()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n < len(expected) {
+			expected = expected[:n]
+		}
+
+		actual, err := NewDataset(input.Clone()).TopN(n, Desc("spend"), Asc("customer")).Collect()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(expected) == 0 && len(actual) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(expected, actual) {
+			t.Fatalf("n = %d\nexpected: %v\nactual: %v", n, expected, actual)
+		}
+	}
+}
+
+func TestDatasetTopNNumericStrings(t *testing.T) {
+	input := &RecordIterator{
+		{"customer": "a", "spend": "9"},
+		{"customer": "b", "spend": "100"},
+		{"customer": "c", "spend": "10"},
+		{"customer": "d", "spend": "25.5"},
+	}
+	expected := []Record{
+		{"customer": "b", "spend": "100"},
+		{"customer": "d", "spend": "25.5"},
+	}
+
+	actual, err := NewDataset(input).TopN(2, Desc("spend")).Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected: %v\nactual: %v", expected, actual)
+	}
+}
+
+func TestDatasetTopNStable(t *testing.T) {
+	input := &RecordIterator{
+		{"id": 1, "spend": 5},
+		{"id": 2, "spend": 9},
+		{"id": 3, "spend": 5},
+		{"id": 4, "spend": 5},
+	}
+	expected := []Record{
+		{"id": 2, "spend": 9},
+		{"id": 1, "spend": 5},
+		{"id": 3, "spend": 5},
+	}
+
+	actual, err := NewDataset(input).TopN(3, Desc("spend")).Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected: %v\nactual: %v", expected, actual)
+	}
+}
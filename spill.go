@@ -0,0 +1,315 @@
+package shred
+
+import (
+	"bufio"
+	"encoding/gob"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// DefaultMemoryBudget is the number of bytes of records that an operator
+// holds in memory before it spills to disk, unless the dataset sets its own
+// budget with MemoryBudget.
+var DefaultMemoryBudget int64 = 256 << 20
+
+func init() {
+	// Concrete types that may appear as record values or aggregation states.
+	gob.Register(time.Time{})
+	gob.Register([]interface{}{})
+	gob.Register(map[string]interface{}{})
+	gob.Register(map[interface{}]bool{})
+	gob.Register(avgState{})
+	gob.Register(percentileState{})
+}
+
+// registered holds the value types that registerValue has seen.
+var registered sync.Map
+
+// registerValues registers the concrete type of every value of rec with gob,
+// so that values of any type, such as a gocql.UUID, can be spilled. Spill
+// files are only read back by the same process, which knows the types.
+func registerValues(rec Record) error {
+	for _, v := range rec {
+		if err := registerValue(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func registerValue(v interface{}) (err error) {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		for _, elem := range v {
+			if err := registerValue(elem); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		for _, elem := range v {
+			if err := registerValue(elem); err != nil {
+				return err
+			}
+		}
+	case map[interface{}]bool:
+		for key := range v {
+			if err := registerValue(key); err != nil {
+				return err
+			}
+		}
+	}
+
+	typ := reflect.TypeOf(v)
+	if _, ok := registered.Load(typ); ok {
+		return nil
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("shred: cannot spill values of type %v: %v", typ, r)
+		}
+	}()
+	gob.Register(v)
+	registered.Store(typ, true)
+	return nil
+}
+
+// spillFile is a temporary file of gob encoded records. Records are written
+// first, then the file is rewound and read back in the same order.
+type spillFile struct {
+	file   *os.File
+	path   string
+	parked bool
+	writer *bufio.Writer
+	enc    *gob.Encoder
+	dec    *gob.Decoder
+}
+
+func createSpillFile() (*spillFile, error) {
+	file, err := os.CreateTemp("", "shred-spill-*")
+	if err != nil {
+		return nil, err
+	}
+
+	writer := bufio.NewWriter(file)
+	return &spillFile{
+		file:   file,
+		path:   file.Name(),
+		writer: writer,
+		enc:    gob.NewEncoder(writer),
+	}, nil
+}
+
+func (s *spillFile) Write(rec Record) error {
+	if err := registerValues(rec); err != nil {
+		return err
+	}
+	return s.enc.Encode(rec)
+}
+
+// Park flushes the written records and closes the file, so that files waiting
+// to be read don't each hold a descriptor. Rewind reopens it.
+func (s *spillFile) Park() error {
+	if err := s.writer.Flush(); err != nil {
+		return err
+	}
+
+	s.parked = true
+	return s.file.Close()
+}
+
+func (s *spillFile) Rewind() error {
+	if s.parked {
+		file, err := os.Open(s.path)
+		if err != nil {
+			return err
+		}
+		s.file, s.parked = file, false
+	} else if err := s.writer.Flush(); err != nil {
+		return err
+	} else if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	s.dec = gob.NewDecoder(bufio.NewReader(s.file))
+	return nil
+}
+
+func (s *spillFile) Clone() Iterator {
+	panic("shred: spill file cannot be cloned")
+}
+
+func (s *spillFile) Next() (Record, error) {
+	var rec Record
+	if err := s.dec.Decode(&rec); err == io.EOF {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return rec, nil
+}
+
+func (s *spillFile) Remove() error {
+	if !s.parked {
+		s.file.Close()
+	}
+	return os.Remove(s.path)
+}
+
+func removeSpillFiles(files []*spillFile) {
+	for _, file := range files {
+		if file != nil {
+			file.Remove()
+		}
+	}
+}
+
+// recordSize estimates the number of bytes a record occupies in memory.
+func recordSize(rec Record) int64 {
+	size := int64(48)
+	for k, v := range rec {
+		size += 32 + int64(len(k)) + valueSize(v)
+	}
+	return size
+}
+
+func valueSize(v interface{}) int64 {
+	switch v := v.(type) {
+	case string:
+		return 16 + int64(len(v))
+	case []byte:
+		return 24 + int64(len(v))
+	case []interface{}:
+		size := int64(24)
+		for _, elem := range v {
+			size += 16 + valueSize(elem)
+		}
+		return size
+	case map[string]interface{}:
+		return recordSize(Record(v))
+	case Record:
+		return recordSize(v)
+	case map[interface{}]bool:
+		size := int64(48)
+		for key := range v {
+			size += 24 + valueSize(key)
+		}
+		return size
+	case percentileState:
+		return 64 + 16*int64(len(v.Means))
+	default:
+		return 16
+	}
+}
+
+// spillPartitions is the number of buckets that records are hashed into when
+// an operator partitions its input to disk.
+const spillPartitions = 16
+
+func createSpillFiles(n int) ([]*spillFile, error) {
+	files := make([]*spillFile, n)
+	for i := range files {
+		file, err := createSpillFile()
+		if err != nil {
+			removeSpillFiles(files)
+			return nil, err
+		}
+		files[i] = file
+	}
+	return files, nil
+}
+
+func rewindSpillFiles(files []*spillFile) error {
+	for _, file := range files {
+		if err := file.Rewind(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// partitionOf assigns a key to one of the spill partitions. A different seed
+// is used each time a partition is split again so that its keys spread out.
+func partitionOf(key interface{}, seed int) int {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%d:%#v", seed, key)
+	return int(h.Sum32() % spillPartitions)
+}
+
+// partitionIterator emits the results of processing each spilled partition
+// in turn. A partition is made of the files at the same index in each of the
+// inputs, which are removed once its results have been read.
+type partitionIterator struct {
+	partitions [][]*spillFile
+	files      []*spillFile
+	current    Iterator
+	process    func([]*spillFile) (Iterator, error)
+}
+
+func newPartitionIterator(process func([]*spillFile) (Iterator, error), inputs ...[]*spillFile) *partitionIterator {
+	partitions := make([][]*spillFile, spillPartitions)
+	for i := range partitions {
+		for _, input := range inputs {
+			partitions[i] = append(partitions[i], input[i])
+		}
+	}
+
+	return &partitionIterator{partitions: partitions, process: process}
+}
+
+func (p *partitionIterator) Clone() Iterator {
+	panic("shred: partition iterator cannot be cloned")
+}
+
+func (p *partitionIterator) Next() (Record, error) {
+	for {
+		if p.current != nil {
+			next, err := p.current.Next()
+			if err != nil {
+				p.remove()
+				return nil, err
+			} else if next != nil {
+				return next, nil
+			}
+
+			removeSpillFiles(p.files)
+			p.files, p.current = nil, nil
+		}
+
+		if len(p.partitions) == 0 {
+			return nil, nil
+		}
+
+		p.files = p.partitions[0]
+		p.partitions = p.partitions[1:]
+
+		var err error
+		if p.current, err = p.process(p.files); err != nil {
+			p.remove()
+			return nil, err
+		}
+	}
+}
+
+// Close removes the partitions that have not been processed yet.
+func (p *partitionIterator) Close() error {
+	err := closeIterator(p.current)
+	p.remove()
+	return err
+}
+
+func (p *partitionIterator) remove() {
+	removeSpillFiles(p.files)
+	for _, files := range p.partitions {
+		removeSpillFiles(files)
+	}
+	p.files, p.partitions, p.current = nil, nil, nil
+}
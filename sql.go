@@ -1,15 +1,18 @@
 package shred
 
 import (
+	"context"
 	"database/sql"
 )
 
 type SqlIterator struct {
+	ctx   context.Context
 	query string
 	db    *sql.DB
 	rows  *sql.Rows
 	buf   []interface{}
 	cols  []string
+	done  bool
 }
 
 func NewSqlIterator(db *sql.DB, query string) *SqlIterator {
@@ -23,13 +26,31 @@ func NewSqlIterator(db *sql.DB, query string) *SqlIterator {
 }
 
 func (s *SqlIterator) Clone() Iterator {
-	return NewSqlIterator(s.db, s.query)
+	clone := NewSqlIterator(s.db, s.query)
+	clone.ctx = s.ctx
+	return clone
+}
+
+// WithContext returns a copy of the iterator that runs its query with ctx.
+func (s *SqlIterator) WithContext(ctx context.Context) Iterator {
+	clone := NewSqlIterator(s.db, s.query)
+	clone.ctx = ctx
+	return clone
 }
 
 func (s *SqlIterator) Next() (Record, error) {
+	if s.done {
+		return nil, nil
+	}
+
 	if s.rows == nil {
 		var err error
-		s.rows, err = s.db.Query(s.query)
+		ctx := s.ctx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+
+		s.rows, err = s.db.QueryContext(ctx, s.query)
 		if err != nil {
 			return nil, err
 		}
@@ -47,8 +68,9 @@ func (s *SqlIterator) Next() (Record, error) {
 	}
 
 	if !s.rows.Next() {
+		err := s.rows.Err()
 		s.rows.Close()
-		return nil, nil
+		return nil, err
 	}
 
 	if err := s.rows.Scan(s.buf...); err != nil {
@@ -63,3 +85,14 @@ func (s *SqlIterator) Next() (Record, error) {
 
 	return next, nil
 }
+
+// Close releases the rows of the query. Next returns no more records
+// afterwards.
+func (s *SqlIterator) Close() error {
+	s.done = true
+	if s.rows == nil {
+		return nil
+	}
+
+	return s.rows.Close()
+}
@@ -48,3 +48,22 @@ func TestSqlIterator(t *testing.T) {
 		t.Fatalf("\nexpected: %v\n  actual: %v", expected, actual)
 	}
 }
+
+func TestSqlIteratorLimit(t *testing.T) {
+	db := MysqlConnection(t)
+	defer db.Close()
+
+	users := NewSqlIterator(db, "SELECT user_id FROM users ORDER BY user_id")
+	expected := []Record{
+		{"user_id": "1"},
+	}
+
+	actual, err := NewDataset(users).Limit(1).Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("\nexpected: %v\n  actual: %v", expected, actual)
+	}
+}
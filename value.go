@@ -0,0 +1,197 @@
+package shred
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	default:
+		if i, ok := toInt64(v); ok {
+			return float64(i), true
+		}
+		return 0, false
+	}
+}
+
+func toInt64(v interface{}) (int64, bool) {
+	switch v := v.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	default:
+		return 0, false
+	}
+}
+
+// toNumber converts v to an int or a float64, parsing numeric strings.
+func toNumber(v interface{}) (interface{}, bool) {
+	if i, ok := toInt64(v); ok {
+		return int(i), true
+	} else if f, ok := toFloat(v); ok {
+		return f, true
+	} else if s, ok := v.(string); ok {
+		if i, err := strconv.Atoi(s); err == nil {
+			return i, true
+		} else if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f, true
+		}
+	}
+
+	return nil, false
+}
+
+func addNumbers(a, b interface{}) interface{} {
+	if a == nil {
+		return b
+	} else if b == nil {
+		return a
+	}
+
+	ai, aok := a.(int)
+	bi, bok := b.(int)
+	if aok && bok {
+		return ai + bi
+	}
+
+	af, _ := toFloat(a)
+	bf, _ := toFloat(b)
+	return af + bf
+}
+
+// compareValues imposes a total order on record values: nil sorts first,
+// followed by booleans, numbers, strings and times. Values of any other type
+// sort last and are compared by their formatted representation. Strings that
+// parse as numbers are compared as numbers, like keys in normalizeKey.
+func compareValues(a, b interface{}) int {
+	a, b = parseNumeric(a), parseNumeric(b)
+	aRank, bRank := valueRank(a), valueRank(b)
+	if aRank != bRank {
+		return compareInts(int64(aRank), int64(bRank))
+	}
+
+	switch aRank {
+	case rankNil:
+		return 0
+	case rankBool:
+		return compareInts(boolInt(a.(bool)), boolInt(b.(bool)))
+	case rankNumber:
+		ai, aok := toInt64(a)
+		bi, bok := toInt64(b)
+		if aok && bok {
+			return compareInts(ai, bi)
+		}
+
+		af, _ := toFloat(a)
+		bf, _ := toFloat(b)
+		switch {
+		case af < bf:
+			return -1
+		case af > bf:
+			return 1
+		default:
+			return 0
+		}
+	case rankString:
+		return strings.Compare(a.(string), b.(string))
+	case rankTime:
+		at, bt := a.(time.Time), b.(time.Time)
+		switch {
+		case at.Before(bt):
+			return -1
+		case at.After(bt):
+			return 1
+		default:
+			return 0
+		}
+	default:
+		return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+	}
+}
+
+// parseNumeric converts a numeric string to an int64 or a float64 and returns
+// any other value unchanged.
+func parseNumeric(v interface{}) interface{} {
+	s, ok := v.(string)
+	if !ok {
+		return v
+	}
+
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i
+	} else if f, err := strconv.ParseFloat(s, 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+		return f
+	}
+
+	return v
+}
+
+const (
+	rankNil = iota
+	rankBool
+	rankNumber
+	rankString
+	rankTime
+	rankOther
+)
+
+func valueRank(v interface{}) int {
+	if v == nil {
+		return rankNil
+	}
+
+	switch v.(type) {
+	case bool:
+		return rankBool
+	case string:
+		return rankString
+	case time.Time:
+		return rankTime
+	}
+
+	if _, ok := toFloat(v); ok {
+		return rankNumber
+	}
+
+	return rankOther
+}
+
+func compareInts(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}